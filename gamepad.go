@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type gamepad struct {
+	controller *sdl.GameController
+	port       int
+	buttons    map[uint8]bool
+	axes       map[uint8]int16
+}
+
+//Plugged in pads take the lowest free controller port
+type gamepads struct {
+	pads map[sdl.JoystickID]*gamepad
+}
+
+func MakeNewGamepads() *gamepads {
+	return &gamepads{pads: map[sdl.JoystickID]*gamepad{}}
+}
+
+//SDL reports pads connected at startup as added too
+func (g *gamepads) added(index int) {
+	if !sdl.IsGameController(index) {
+		return
+	}
+	port := g.freePort()
+	if port < 0 {
+		return
+	}
+	controller := sdl.GameControllerOpen(index)
+	if controller == nil {
+		return
+	}
+
+	id := controller.Joystick().InstanceID()
+	g.pads[id] = &gamepad{
+		controller: controller,
+		port:       port,
+		buttons:    map[uint8]bool{},
+		axes:       map[uint8]int16{},
+	}
+	log.Printf("gamepad %v on port %v", id, port+1)
+}
+
+func (g *gamepads) removed(id sdl.JoystickID) {
+	pad, ok := g.pads[id]
+	if !ok {
+		return
+	}
+	pad.controller.Close()
+	delete(g.pads, id)
+}
+
+func (g *gamepads) freePort() int {
+	for port := 0; port < inputPorts; port++ {
+		if len(g.onPort(port)) == 0 {
+			return port
+		}
+	}
+	return -1
+}
+
+func (g *gamepads) onPort(port int) []*gamepad {
+	var pads []*gamepad
+	for _, pad := range g.pads {
+		if pad.port == port {
+			pads = append(pads, pad)
+		}
+	}
+	return pads
+}
+
+func (g *gamepads) button(id sdl.JoystickID, button uint8, isPressed bool) {
+	if pad, ok := g.pads[id]; ok {
+		pad.buttons[button] = isPressed
+	}
+}
+
+func (g *gamepads) axis(id sdl.JoystickID, axis uint8, value int16) {
+	if pad, ok := g.pads[id]; ok {
+		pad.axes[axis] = value
+	}
+}
+
+func (g *gamepads) close() {
+	for id := range g.pads {
+		g.removed(id)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func addTestGamepad(g *gamepads, id sdl.JoystickID, port int) {
+	g.pads[id] = &gamepad{port: port, buttons: map[uint8]bool{}, axes: map[uint8]int16{}}
+}
+
+func TestGamepadPorts(t *testing.T) {
+	g := MakeNewGamepads()
+	if port := g.freePort(); port != 0 {
+		t.Errorf("first pad should go to port 1, got %v", port+1)
+	}
+
+	addTestGamepad(g, 7, 0)
+	if port := g.freePort(); port != 1 {
+		t.Errorf("second pad should go to port 2, got %v", port+1)
+	}
+	addTestGamepad(g, 9, 1)
+	addTestGamepad(g, 10, 2)
+	addTestGamepad(g, 11, 3)
+	if port := g.freePort(); port != -1 {
+		t.Errorf("a fifth pad should not get a port, got %v", port+1)
+	}
+
+	g.button(9, sdl.CONTROLLER_BUTTON_B, true)
+	g.axis(9, sdl.CONTROLLER_AXIS_LEFTX, -20000)
+	g.button(3, sdl.CONTROLLER_BUTTON_START, true) //not plugged in
+	pads := g.onPort(1)
+	if len(pads) != 1 || !pads[0].buttons[sdl.CONTROLLER_BUTTON_B] || pads[0].axes[sdl.CONTROLLER_AXIS_LEFTX] != -20000 {
+		t.Errorf("pad on port 2 should have B and left x recorded")
+	}
+
+	delete(g.pads, 7)
+	if port := g.freePort(); port != 0 {
+		t.Errorf("unplugging should free port 1, got %v", port+1)
+	}
+}
@@ -0,0 +1,5 @@
+module nelr
+
+go 1.15
+
+require github.com/veandco/go-sdl2 v0.4.39
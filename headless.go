@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+
+	"nelr/nes"
+)
+
+//Runs a number of frames without touching SDL, for tests and CI.
+//The last frame is written as a PNG when screenshotPath is set.
+//Stops early with a *nes.HaltError when the CPU halts.
+func runHeadless(console *nes.NES, frames uint64, screenshotPath string) error {
+	var halt error
+	for i := uint64(0); i < frames && halt == nil; i++ {
+		console.StepFrame()
+		console.AudioSamples()
+		if err := console.Halted(); err != nil {
+			halt = fmt.Errorf("frame %v: %w", i+1, err)
+		}
+	}
+
+	if screenshotPath == "" {
+		return halt
+	}
+	file, err := os.Create(screenshotPath)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(file, console.Frame())
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return halt
+}
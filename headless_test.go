@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nelr/nes"
+)
+
+//NROM spinning on JMP $8000
+func makeHeadlessTestNES(t *testing.T) *nes.NES {
+	header := [16]byte{'N', 'E', 'S', 0x1A, 2, 1}
+	rom := append(header[:], make([]byte, 2*0x4000+0x2000)...)
+	copy(rom[16:], []byte{0x4C, 0x00, 0x80})
+	rom[16+0x7FFD] = 0x80
+	console, err := nes.New(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return console
+}
+
+func TestRunHeadlessScreenshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nelr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "frame.png")
+
+	console := makeHeadlessTestNES(t)
+
+	if err := runHeadless(console, 2, path); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	frame, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Bounds().Dx() != nes.ScreenWidth || frame.Bounds().Dy() != nes.ScreenHeight {
+		t.Errorf("unexpected screenshot size %v", frame.Bounds())
+	}
+}
+
+func TestRunHeadlessStopsOnHalt(t *testing.T) {
+	header := [16]byte{'N', 'E', 'S', 0x1A, 2, 1}
+	rom := append(header[:], make([]byte, 2*0x4000+0x2000)...)
+	rom[16] = 0x02 //STP at $8000
+	rom[16+0x7FFD] = 0x80
+	console, err := nes.New(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runHeadless(console, 600, "")
+	var halt *nes.HaltError
+	if !errors.As(err, &halt) || halt.PC != 0x8000 || halt.Opcode != 0x02 {
+		t.Errorf("expected a halt on $02 at $8000, got %v", err)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"nelr/nes"
+)
+
+//Ports 3 and 4 are behind a multitap
+const inputPorts = 4
+
+//Sticks count as pressed past half way
+const axisThreshold = 16384
+
+const (
+	inputKey    = "key"    //keyboard scancode, any port
+	inputButton = "button" //button on the pad plugged into the port
+	inputAxis   = "axis"   //stick or trigger on the pad plugged into the port
+)
+
+//A physical input, e.g. key:Left, button:dpleft or axis:leftx-
+type input struct {
+	kind string
+	code int
+	sign int //axes only, +1 or -1
+}
+
+func parseInput(s string) (input, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return input{}, fmt.Errorf("input %q is not kind:name", s)
+	}
+	kind, name := parts[0], parts[1]
+
+	switch kind {
+	case inputKey:
+		scancode := sdl.GetScancodeFromName(name)
+		if scancode == sdl.SCANCODE_UNKNOWN {
+			return input{}, fmt.Errorf("unknown key %q", name)
+		}
+		return input{kind: kind, code: int(scancode)}, nil
+	case inputButton:
+		button := sdl.GameControllerGetButtonFromString(name)
+		if button == sdl.CONTROLLER_BUTTON_INVALID {
+			return input{}, fmt.Errorf("unknown gamepad button %q", name)
+		}
+		return input{kind: kind, code: int(button)}, nil
+	case inputAxis:
+		sign := 1
+		if strings.HasSuffix(name, "-") {
+			sign = -1
+		} else if !strings.HasSuffix(name, "+") {
+			return input{}, fmt.Errorf("axis %q needs a + or - direction", name)
+		}
+		axis := sdl.GameControllerGetAxisFromString(name[:len(name)-1])
+		if axis == sdl.CONTROLLER_AXIS_INVALID {
+			return input{}, fmt.Errorf("unknown gamepad axis %q", name)
+		}
+		return input{kind: kind, code: int(axis), sign: sign}, nil
+	}
+	return input{}, fmt.Errorf("unknown input kind %q", kind)
+}
+
+func (in input) String() string {
+	switch in.kind {
+	case inputKey:
+		return inputKey + ":" + sdl.GetScancodeName(sdl.Scancode(in.code))
+	case inputButton:
+		return inputButton + ":" + sdl.GameControllerGetStringForButton(sdl.GameControllerButton(in.code))
+	case inputAxis:
+		direction := "+"
+		if in.sign < 0 {
+			direction = "-"
+		}
+		return inputAxis + ":" + sdl.GameControllerGetStringForAxis(sdl.GameControllerAxis(in.code)) + direction
+	}
+	return in.kind
+}
+
+//Order of the press-a-key-to-bind flow
+var nesButtonNames = []string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right"}
+
+//Bindable buttons, the turbo version of a button lives in the high byte
+var nesButtons = map[string]uint16{
+	"A":      nes.ButtonA,
+	"B":      nes.ButtonB,
+	"Select": nes.ButtonSelect,
+	"Start":  nes.ButtonStart,
+	"Up":     nes.ButtonUp,
+	"Down":   nes.ButtonDown,
+	"Left":   nes.ButtonLeft,
+	"Right":  nes.ButtonRight,
+}
+
+//nesButtonNames followed by TurboA to TurboRight
+var bindingNames []string
+
+//The input file, a bare list of bindings is accepted too
+type inputConfig struct {
+	TurboRate int            `json:"turboRate,omitempty"` //frames, see nes.DefaultTurboRate
+	Bindings  []inputBinding `json:"bindings"`
+	Macros    []inputMacro   `json:"macros,omitempty"`
+}
+
+//One line of the bindings file, port is 1 to 4
+type inputBinding struct {
+	Port   int    `json:"port"`
+	Button string `json:"button"`
+	Input  string `json:"input"`
+}
+
+//Runs steps on port when input is pressed
+type inputMacro struct {
+	Name  string      `json:"name"`
+	Port  int         `json:"port"`
+	Input string      `json:"input"`
+	Steps []macroStep `json:"steps"`
+}
+
+//Buttons held together for a number of frames
+type macroStep struct {
+	Buttons []string `json:"buttons"`
+	Frames  int      `json:"frames"`
+}
+
+var defaultBindings = []inputBinding{
+	{1, "A", "key:A"}, {1, "B", "key:S"}, {1, "Select", "key:X"}, {1, "Start", "key:Z"},
+	{1, "Up", "key:Up"}, {1, "Down", "key:Down"}, {1, "Left", "key:Left"}, {1, "Right", "key:Right"},
+	{2, "A", "key:G"}, {2, "B", "key:H"}, {2, "Select", "key:T"}, {2, "Start", "key:Y"},
+	{2, "Up", "key:I"}, {2, "Down", "key:K"}, {2, "Left", "key:J"}, {2, "Right", "key:L"},
+	{1, "TurboA", "key:Q"}, {1, "TurboB", "key:W"},
+	{2, "TurboA", "key:U"}, {2, "TurboB", "key:O"},
+}
+
+//Pads are laid out like the NES pad, A on the right and turbo above
+func init() {
+	for _, name := range nesButtonNames {
+		nesButtons["Turbo"+name] = nesButtons[name] << 8
+		bindingNames = append(bindingNames, name)
+	}
+	for _, name := range nesButtonNames {
+		bindingNames = append(bindingNames, "Turbo"+name)
+	}
+
+	padBindings := []inputBinding{
+		{0, "A", "button:b"}, {0, "B", "button:a"}, {0, "Select", "button:back"}, {0, "Start", "button:start"},
+		{0, "TurboA", "button:y"}, {0, "TurboB", "button:x"},
+		{0, "Up", "button:dpup"}, {0, "Down", "button:dpdown"}, {0, "Left", "button:dpleft"}, {0, "Right", "button:dpright"},
+		{0, "Up", "axis:lefty-"}, {0, "Down", "axis:lefty+"}, {0, "Left", "axis:leftx-"}, {0, "Right", "axis:leftx+"},
+	}
+	for port := 1; port <= 2; port++ {
+		for _, binding := range padBindings {
+			binding.Port = port
+			defaultBindings = append(defaultBindings, binding)
+		}
+	}
+}
+
+//<user config dir>/nelr/input.json
+func defaultBindingsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "input.json"
+	}
+	return filepath.Join(dir, "nelr", "input.json")
+}
+
+//A missing file means the default layout
+func loadInputConfig(path string) (inputConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return inputConfig{Bindings: defaultBindings}, nil
+	}
+	if err != nil {
+		return inputConfig{}, err
+	}
+
+	var config inputConfig
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &config.Bindings)
+	} else {
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return inputConfig{}, fmt.Errorf("%v: %v", path, err)
+	}
+	return config, nil
+}
+
+func saveInputConfig(path string, config inputConfig) error {
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+//Turns keyboard and pad state into NES buttons per port
+type inputMapper struct {
+	bindings [inputPorts]map[input]uint16
+	macros   []portMacro
+	keys     map[sdl.Scancode]bool
+	pads     *gamepads
+	config   inputConfig
+
+	//Press-a-key-to-bind flow, bindButton is -1 when idle
+	bindPort   int
+	bindButton int
+}
+
+type portMacro struct {
+	port  int
+	input input
+	macro nes.Macro
+}
+
+func MakeNewInputMapper(config inputConfig, pads *gamepads) (*inputMapper, error) {
+	m := &inputMapper{
+		keys:       map[sdl.Scancode]bool{},
+		pads:       pads,
+		config:     config,
+		bindButton: -1,
+	}
+	for port := range m.bindings {
+		m.bindings[port] = map[input]uint16{}
+	}
+
+	for _, binding := range config.Bindings {
+		button, ok := nesButtons[binding.Button]
+		if !ok {
+			return nil, fmt.Errorf("unknown NES button %q", binding.Button)
+		}
+		if binding.Port < 1 || binding.Port > len(m.bindings) {
+			return nil, fmt.Errorf("%v: port %v does not exist", binding.Input, binding.Port)
+		}
+		in, err := parseInput(binding.Input)
+		if err != nil {
+			return nil, err
+		}
+		m.bindings[binding.Port-1][in] |= button
+	}
+
+	for _, macro := range config.Macros {
+		if macro.Port < 1 || macro.Port > len(m.bindings) {
+			return nil, fmt.Errorf("macro %v: port %v does not exist", macro.Name, macro.Port)
+		}
+		in, err := parseInput(macro.Input)
+		if err != nil {
+			return nil, fmt.Errorf("macro %v: %v", macro.Name, err)
+		}
+		frames, err := macroFrames(macro.Steps)
+		if err != nil {
+			return nil, fmt.Errorf("macro %v: %v", macro.Name, err)
+		}
+		m.macros = append(m.macros, portMacro{macro.Port - 1, in, nes.Macro{Name: macro.Name, Frames: frames}})
+	}
+	return m, nil
+}
+
+//One button mask per frame
+func macroFrames(steps []macroStep) ([]byte, error) {
+	var frames []byte
+	for _, step := range steps {
+		var mask byte
+		for _, name := range step.Buttons {
+			button, ok := nesButtons[name]
+			if !ok || button > 0xFF {
+				return nil, fmt.Errorf("unknown NES button %q", name)
+			}
+			mask |= byte(button)
+		}
+		for i := 0; i < step.Frames; i++ {
+			frames = append(frames, mask)
+		}
+	}
+	return frames, nil
+}
+
+//Held buttons and held turbo buttons
+func (m *inputMapper) buttons(port int) (byte, byte) {
+	var mask uint16
+	for in, buttons := range m.bindings[port] {
+		if m.isActive(port, in) {
+			mask |= buttons
+		}
+	}
+	return byte(mask), byte(mask >> 8)
+}
+
+//Macros started by pressing in, padPort is the port of the pad in came from
+func (m *inputMapper) macrosFor(in input, padPort int) []portMacro {
+	var macros []portMacro
+	for _, macro := range m.macros {
+		if macro.input == in && (in.kind == inputKey || macro.port == padPort) {
+			macros = append(macros, macro)
+		}
+	}
+	return macros
+}
+
+//-1 for pads without a port
+func (m *inputMapper) padPort(id sdl.JoystickID) int {
+	if pad, ok := m.pads.pads[id]; ok {
+		return pad.port
+	}
+	return -1
+}
+
+func (m *inputMapper) isActive(port int, in input) bool {
+	if in.kind == inputKey {
+		return m.keys[sdl.Scancode(in.code)]
+	}
+	for _, pad := range m.pads.onPort(port) {
+		if in.kind == inputButton && pad.buttons[uint8(in.code)] {
+			return true
+		}
+		if in.kind == inputAxis && int(pad.axes[uint8(in.code)])*in.sign > axisThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+//Reports the axis direction when a pad's axis moves past the threshold,
+//call it before the pad records the new value
+func (m *inputMapper) axisPushed(id sdl.JoystickID, axis uint8, value int16) (input, bool) {
+	pad, ok := m.pads.pads[id]
+	if !ok {
+		return input{}, false
+	}
+	in := input{kind: inputAxis, code: int(axis), sign: 1}
+	if value < 0 {
+		in.sign = -1
+	}
+	wasPushed := int(pad.axes[axis])*in.sign > axisThreshold
+	isPushed := int(value)*in.sign > axisThreshold
+	return in, isPushed && !wasPushed
+}
+
+func (m *inputMapper) isBinding() bool {
+	return m.bindButton >= 0
+}
+
+func (m *inputMapper) startBinding(port int) {
+	m.bindPort = port
+	m.bindButton = 0
+}
+
+func (m *inputMapper) bindingPrompt() string {
+	return fmt.Sprintf("Port %v: press the input for %v, Escape skips", m.bindPort+1, nesButtonNames[m.bindButton])
+}
+
+//Replaces the prompted button's keys, or its pad inputs for a pad input,
+//with in and skips the button when in is nil. in drops any button it had before.
+//Returns true once the last button has been prompted.
+func (m *inputMapper) bind(in *input) bool {
+	button := nesButtons[nesButtonNames[m.bindButton]]
+	if in != nil {
+		bindings := m.bindings[m.bindPort]
+		for bound := range bindings {
+			if (bound.kind == inputKey) != (in.kind == inputKey) {
+				continue
+			}
+			bindings[bound] &^= button
+			if bindings[bound] == 0 {
+				delete(bindings, bound)
+			}
+		}
+		bindings[*in] = button
+	}
+
+	m.bindButton++
+	if m.bindButton == len(nesButtonNames) {
+		m.bindButton = -1
+		return true
+	}
+	return false
+}
+
+//Back to the file format, sorted by port and button for stable output
+func (m *inputMapper) inputConfig() inputConfig {
+	config := m.config
+	config.Bindings = nil
+	for port := range m.bindings {
+		for _, name := range bindingNames {
+			var inputs []string
+			for in, buttons := range m.bindings[port] {
+				if buttons&nesButtons[name] != 0 {
+					inputs = append(inputs, in.String())
+				}
+			}
+			sort.Strings(inputs)
+			for _, in := range inputs {
+				config.Bindings = append(config.Bindings, inputBinding{port + 1, name, in})
+			}
+		}
+	}
+	return config
+}
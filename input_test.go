@@ -0,0 +1,190 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"nelr/nes"
+)
+
+func TestParseInput(t *testing.T) {
+	for _, s := range []string{"key:Left", "button:dpup", "axis:leftx-", "axis:lefty+"} {
+		in, err := parseInput(s)
+		if err != nil {
+			t.Errorf("%v: %v", s, err)
+			continue
+		}
+		if in.String() != s {
+			t.Errorf("%v came back as %v", s, in)
+		}
+	}
+	for _, s := range []string{"Left", "key:NoSuchKey", "button:nope", "axis:leftx", "mouse:left"} {
+		if _, err := parseInput(s); err == nil {
+			t.Errorf("%v should not parse", s)
+		}
+	}
+}
+
+func TestInputMapper(t *testing.T) {
+	pads := MakeNewGamepads()
+	addTestGamepad(pads, 4, 1)
+	m, err := MakeNewInputMapper(inputConfig{Bindings: defaultBindings}, pads)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.keys[sdl.SCANCODE_Z] = true
+	m.keys[sdl.SCANCODE_X] = true
+	m.keys[sdl.SCANCODE_G] = true
+	if got, _ := m.buttons(0); got != nes.ButtonStart|nes.ButtonSelect {
+		t.Errorf("Z and X should be Start and Select on port 1, got %08b", got)
+	}
+
+	pads.button(4, sdl.CONTROLLER_BUTTON_START, true)
+	pads.axis(4, sdl.CONTROLLER_AXIS_LEFTX, -30000)
+	pads.axis(4, sdl.CONTROLLER_AXIS_LEFTY, 1000) //inside the dead zone
+	pads.button(4, sdl.CONTROLLER_BUTTON_X, true)
+	got, turbo := m.buttons(1)
+	if want := byte(nes.ButtonA | nes.ButtonStart | nes.ButtonLeft); got != want {
+		t.Errorf("port 2 should be %08b, got %08b", want, got)
+	}
+	if turbo != nes.ButtonB {
+		t.Errorf("pad X should be turbo B, got %08b", turbo)
+	}
+
+	if _, err := MakeNewInputMapper(inputConfig{Bindings: []inputBinding{{5, "A", "key:A"}}}, pads); err == nil {
+		t.Errorf("port 5 should be rejected")
+	}
+	if _, err := MakeNewInputMapper(inputConfig{Bindings: []inputBinding{{1, "Turbo", "key:A"}}}, pads); err == nil {
+		t.Errorf("unknown NES buttons should be rejected")
+	}
+}
+
+func TestAxisPushed(t *testing.T) {
+	pads := MakeNewGamepads()
+	addTestGamepad(pads, 0, 0)
+	m, _ := MakeNewInputMapper(inputConfig{}, pads)
+
+	in, isPushed := m.axisPushed(0, sdl.CONTROLLER_AXIS_LEFTY, -30000)
+	if !isPushed || in.String() != "axis:lefty-" {
+		t.Errorf("pushing up should report axis:lefty-, got %v %v", in, isPushed)
+	}
+	pads.axis(0, sdl.CONTROLLER_AXIS_LEFTY, -30000)
+	if _, isPushed := m.axisPushed(0, sdl.CONTROLLER_AXIS_LEFTY, -31000); isPushed {
+		t.Errorf("holding the stick should not report again")
+	}
+}
+
+func TestBindingFlow(t *testing.T) {
+	pads := MakeNewGamepads()
+	m, _ := MakeNewInputMapper(inputConfig{Bindings: defaultBindings}, pads)
+
+	m.startBinding(0)
+	if !m.isBinding() || m.bindingPrompt() != "Port 1: press the input for A, Escape skips" {
+		t.Errorf("unexpected prompt %q", m.bindingPrompt())
+	}
+	m.bind(&input{kind: inputKey, code: int(sdl.SCANCODE_S)})
+	m.bind(&input{kind: inputButton, code: sdl.CONTROLLER_BUTTON_X})
+	for !m.bind(nil) {
+	}
+	if m.isBinding() {
+		t.Errorf("binding should end after Right")
+	}
+
+	m.keys[sdl.SCANCODE_S] = true
+	if got, _ := m.buttons(0); got != nes.ButtonA {
+		t.Errorf("S should now be only A, got %08b", got)
+	}
+	m.keys[sdl.SCANCODE_S] = false
+	m.keys[sdl.SCANCODE_A] = true
+	if got, _ := m.buttons(0); got != 0 {
+		t.Errorf("A should no longer be bound, got %08b", got)
+	}
+
+	bindings := m.inputConfig().Bindings
+	var bButtons []string
+	for _, binding := range bindings {
+		if binding.Port == 1 && binding.Button == "B" {
+			bButtons = append(bButtons, binding.Input)
+		}
+	}
+	if want := []string{"button:x"}; !reflect.DeepEqual(bButtons, want) {
+		t.Errorf("port 1 B should be %v, got %v", want, bButtons)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	pads := MakeNewGamepads()
+	addTestGamepad(pads, 2, 0)
+	config := inputConfig{Macros: []inputMacro{
+		{"fireball", 1, "button:y", []macroStep{{[]string{"Down"}, 2}, {[]string{"Down", "Right"}, 1}, {[]string{"B"}, 1}}},
+		{"jump", 2, "key:Q", []macroStep{{[]string{"A"}, 3}}},
+	}}
+	m, err := MakeNewInputMapper(config, pads)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	macros := m.macrosFor(input{kind: inputButton, code: sdl.CONTROLLER_BUTTON_Y}, m.padPort(2))
+	want := []byte{nes.ButtonDown, nes.ButtonDown, nes.ButtonDown | nes.ButtonRight, nes.ButtonB}
+	if len(macros) != 1 || macros[0].port != 0 || string(macros[0].macro.Frames) != string(want) {
+		t.Errorf("pad Y should start fireball on port 1, got %v", macros)
+	}
+	if macros := m.macrosFor(input{kind: inputButton, code: sdl.CONTROLLER_BUTTON_Y}, 1); len(macros) != 0 {
+		t.Errorf("a pad on port 2 should not start a port 1 macro")
+	}
+	if macros := m.macrosFor(input{kind: inputKey, code: int(sdl.SCANCODE_Q)}, -1); len(macros) != 1 || macros[0].port != 1 {
+		t.Errorf("Q should start jump on port 2, got %v", macros)
+	}
+
+	config.Macros[0].Steps[0].Buttons = []string{"TurboA"}
+	if _, err := MakeNewInputMapper(config, pads); err == nil {
+		t.Errorf("turbo buttons should not be allowed in macros")
+	}
+}
+
+func TestInputConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nelr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nelr", "input.json")
+
+	config, err := loadInputConfig(path)
+	if err != nil || !reflect.DeepEqual(config.Bindings, defaultBindings) {
+		t.Fatalf("a missing file should give the defaults, got %v", err)
+	}
+
+	config.TurboRate = 3
+	config.Macros = []inputMacro{{"jump", 1, "key:W", []macroStep{{[]string{"A"}, 4}}}}
+	m, _ := MakeNewInputMapper(config, MakeNewGamepads())
+	err = saveInputConfig(path, m.inputConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadInputConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, m.inputConfig()) || len(loaded.Bindings) != len(defaultBindings) || loaded.TurboRate != 3 {
+		t.Errorf("input config did not round trip")
+	}
+
+	//A plain list of bindings as written before turbo and macros
+	ioutil.WriteFile(path, []byte(`[{"port": 2, "button": "A", "input": "key:G"}]`), 0644)
+	loaded, err = loadInputConfig(path)
+	if err != nil || len(loaded.Bindings) != 1 || loaded.Bindings[0].Input != "key:G" {
+		t.Errorf("a list of bindings should still load, got %v %v", loaded, err)
+	}
+
+	ioutil.WriteFile(path, []byte("{"), 0644)
+	if _, err := loadInputConfig(path); err == nil {
+		t.Errorf("a broken file should be an error")
+	}
+}
@@ -3,118 +3,388 @@ package main
 //https://github.com/kingcons/famiclom/blob/master/docs/nes.txt
 
 import (
+	"encoding/binary"
+	"flag"
+	"math"
 	"log"
 	"github.com/veandco/go-sdl2/sdl"
 	"os"
 	"fmt"
-)
 
-const (
-	windowHeight = 240
-	windowWidth = 256
-	argbBytes = 4
+	"nelr/nes"
 )
 
-var renderBuffer [windowWidth * windowWidth * argbBytes]byte
-var texture *sdl.Texture
-var err error
-var renderer *sdl.Renderer
-var window *sdl.Window
+var audioDevice sdl.AudioDeviceID
+
+//Audio queued beyond this is dropped instead of piling up latency
+const maxQueuedAudioBytes = nes.SampleRate / 10 * 4
+
+//Device names for -port1, -port2 and -expansion, the expansion port takes
+//the third controller or a Famicom Zapper
+var portDevices = map[string]func(console *nes.NES, port int) nes.PortDevice{
+	"none": func(console *nes.NES, port int) nes.PortDevice {
+		return nil
+	},
+	"controller": func(console *nes.NES, port int) nes.PortDevice {
+		return console.Controller(port)
+	},
+	"zapper": func(console *nes.NES, port int) nes.PortDevice {
+		if port == nes.ExpansionPort {
+			return console.Zapper(nes.Port2)
+		}
+		return console.Zapper(port)
+	},
+}
+
+//-busconflicts values, empty keeps what the rom header says
+var busConflicts = map[string]bool{
+	"on":  true,
+	"off": false,
+}
+
+var multitaps = map[string]nes.Multitap{
+	"none":      nes.MultitapNone,
+	"fourscore": nes.MultitapFourScore,
+	"famicom":   nes.MultitapFamicom,
+}
 
 //https://wiki.libsdl.org/MigrationGuide
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("usage: nelr <rom.nes>")
+	saveDir := flag.String("savedir", "", "directory for battery saves and save states, defaults to the rom's directory")
+	headless := flag.Bool("headless", false, "run without a window or audio for -frames frames")
+	frames := flag.Uint64("frames", 600, "number of frames to run in headless mode")
+	screenshot := flag.String("screenshot", "", "write the last headless frame to this PNG file")
+	diagnostics := flag.Bool("diagnostics", false, "log open bus reads and other unusual bus accesses")
+	busConflictsFlag := flag.String("busconflicts", "", "on or off overrides the rom header's bus conflicts on mappers 2, 3, 7 and 66")
+	fastForward := flag.Float64("fastforward", 4, "speed multiplier while the fast-forward key is held")
+	slowMotion := flag.Float64("slowmotion", 0.25, "speed multiplier in slow motion")
+	port1 := flag.String("port1", "", "device on port 1: controller, zapper or none")
+	port2 := flag.String("port2", "", "device on port 2: controller, zapper or none, Duck Hunt wants a zapper here")
+	expansion := flag.String("expansion", "", "device on the Famicom expansion port: controller, zapper or none")
+	multitap := flag.String("multitap", "none", "four player adapter: none, fourscore or famicom, -port1, -port2 and -expansion override it")
+	inputPath := flag.String("input", defaultBindingsPath(), "input bindings file, F12 rebinds port 1, with Shift port 2, with Ctrl ports 3 and 4")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("usage: nelr [-savedir dir] [-input bindings.json] [-port1 device] [-port2 device] [-expansion device] [-multitap adapter] [-busconflicts on|off] [-fastforward n] [-slowmotion n] [-diagnostics] [-headless [-frames n] [-screenshot out.png]] <rom.nes>")
+		os.Exit(1)
+	}
+	//A speed of 0 or less would stop the pacer from throttling at all
+	if *fastForward <= 0 || *slowMotion <= 0 {
+		fmt.Println("usage: -fastforward and -slowmotion must be greater than 0")
 		os.Exit(1)
 	}
-	
+
 	log.SetFlags(log.Lshortfile)
-	cart := LoadRom(os.Args[1])
-	nes := MakeNewNES(&cart)
-	nes.ppu.Reset()
+	romPath := flag.Arg(0)
+	rom, err := os.Open(romPath)
+	checkError(err)
+	var opts []nes.Option
+	if *diagnostics {
+		opts = append(opts, nes.WithDiagnosticHook(func(d nes.Diagnostic) {
+			log.Println(d)
+		}))
+	}
+	if *busConflictsFlag != "" {
+		enabled, ok := busConflicts[*busConflictsFlag]
+		if !ok {
+			checkError(fmt.Errorf("unknown -busconflicts %q", *busConflictsFlag))
+		}
+		opts = append(opts, nes.WithBusConflicts(enabled))
+	}
+	console, err := nes.New(rom, opts...)
+	rom.Close()
+	checkError(err)
+	err = connectDevices(console, *multitap, [3]string{*port1, *port2, *expansion})
+	checkError(err)
+
+	sav := nes.SavePath(romPath, *saveDir)
+	if console.HasBattery() {
+		err := console.LoadSave(sav)
+		checkError(err)
+	}
+
+	if *headless {
+		err := runHeadless(console, *frames, *screenshot)
+		checkError(err)
+	} else {
+		config, err := loadInputConfig(*inputPath)
+		checkError(err)
+		runSDL(console, romPath, *saveDir, config, *inputPath, *fastForward, *slowMotion)
+	}
+
+	if console.HasBattery() {
+		if err := console.WriteSave(sav); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+//The multitap first, then any device named for a port replaces what it put there
+func connectDevices(console *nes.NES, multitap string, devices [3]string) error {
+	adapter, ok := multitaps[multitap]
+	if !ok {
+		return fmt.Errorf("unknown multitap %q", multitap)
+	}
+	console.ConnectMultitap(adapter)
+
+	for port, name := range devices {
+		if name == "" {
+			continue
+		}
+		device, ok := portDevices[name]
+		if !ok {
+			return fmt.Errorf("unknown device %q", name)
+		}
+		console.ConnectDevice(port, device(console, port))
+	}
+	return nil
+}
+
+//F11 swaps port 2 between a controller and a Zapper
+func swapPort2(console *nes.NES) {
+	if console.Device(nes.Port2) == nes.PortDevice(console.Zapper(nes.Port2)) {
+		console.ConnectDevice(nes.Port2, console.Controller(nes.Port2))
+		log.Println("controller on port 2")
+	} else {
+		console.ConnectDevice(nes.Port2, console.Zapper(nes.Port2))
+		log.Println("zapper on port 2")
+	}
+}
+
+//Tab fast-forwards while held, Backspace toggles slow motion,
+//P pauses, N advances a single frame and F11 swaps port 2 between a controller and a Zapper
+func runSDL(console *nes.NES, romPath string, saveDir string, config inputConfig, inputPath string, fastForward float64, slowMotion float64) {
+	sav := nes.SavePath(romPath, saveDir)
+	pacer := MakeNewFramePacer(console.FrameRate())
 
 	sdl.Init(sdl.INIT_EVERYTHING)
-	window, renderer, err = sdl.CreateWindowAndRenderer(windowWidth, windowHeight, sdl.WINDOW_RESIZABLE)
+	defer sdl.Quit()
+	sink, err := MakeNewSDLFrameSink()
 	checkError(err)
-	texture, err = renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888,	sdl.TEXTUREACCESS_STREAMING, windowWidth, windowHeight)
+	defer sink.Destroy()
+	console.SetFrameSink(sink)
+
+	audioSpec := sdl.AudioSpec{
+		Freq: nes.SampleRate,
+		Format: sdl.AUDIO_F32,
+		Channels: 1,
+		Samples: 1024,
+	}
+	audioDevice, err = sdl.OpenAudioDevice("", false, &audioSpec, nil, 0)
 	checkError(err)
-	
+	defer sdl.CloseAudioDevice(audioDevice)
+	sdl.PauseAudioDevice(audioDevice, false)
+
+	pads := MakeNewGamepads()
+	defer pads.close()
+	mapper, err := MakeNewInputMapper(config, pads)
+	checkError(err)
+	for port := 0; port < inputPorts; port++ {
+		console.SetTurboRate(port, config.TurboRate)
+	}
+
+	var framesSinceFlush int
+	//The mouse aims every Zapper
+	zapperX, zapperY, isTriggerPulled := -1, -1, false
+	var isFastForwarding, isSlowMotion, isPaused, shouldAdvance, isHalted bool
 	var isRunning = true
 	for isRunning {
-		//log.Println(nes.ppu.t)
-		nes.Run()
-		
+		speed := 1.0
+		if isFastForwarding {
+			speed = fastForward
+		} else if isSlowMotion {
+			speed = slowMotion
+		}
+
+		if !isPaused || shouldAdvance {
+			shouldAdvance = false
+			console.StepFrame()
+			//Loading a state can bring a halted CPU back
+			if err := console.Halted(); err != nil && !isHalted {
+				isHalted = true
+				log.Println(err)
+				sink.SetTitle(err.Error())
+			} else if err == nil && isHalted {
+				isHalted = false
+				sink.SetTitle("")
+			}
+			//Sped up or slowed down audio only crackles
+			samples := console.AudioSamples()
+			if speed == 1 && !isPaused {
+				queueAudio(samples)
+			}
+
+			framesSinceFlush++
+			if console.HasBattery() && console.IsSaveDirty() && framesSinceFlush >= nes.SaveFlushFrames {
+				framesSinceFlush = 0
+				if err := console.WriteSave(sav); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 			switch t := event.(type) {
 			case *sdl.QuitEvent:
 				isRunning = false
-				texture.Destroy()
-				renderer.Destroy()
-				window.Destroy()
-				sdl.Quit()
 
 			case *sdl.KeyboardEvent:
-				keyIsReleased := t.Type == sdl.KEYUP
 				keyIsPressed := t.Type == sdl.KEYDOWN
 				keyScancode := t.Keysym.Scancode
-				// log.Printf("keyPressed:%v keyReleased:%v scancode:%v \n", keyIsPressed, keyIsReleased,  keyScancode)
-				if keyIsPressed {
-					nes.controllerButtonPressed(keyScancode)
+				// log.Printf("keyPressed:%v scancode:%v \n", keyIsPressed, keyScancode)
+				mapper.keys[keyScancode] = keyIsPressed
+				if mapper.isBinding() {
+					if keyIsPressed && t.Repeat == 0 {
+						in := &input{kind: inputKey, code: int(keyScancode)}
+						if keyScancode == sdl.SCANCODE_ESCAPE {
+							in = nil
+						}
+						bindInput(mapper, in, sink, inputPath)
+					}
+					break
+				}
+				if keyIsPressed && t.Repeat == 0 {
+					stateHotkeyPressed(console, t.Keysym, romPath, saveDir)
+					playMacros(console, mapper.macrosFor(input{kind: inputKey, code: int(keyScancode)}, -1))
+				}
+
+				if keyScancode == sdl.SCANCODE_TAB {
+					isFastForwarding = keyIsPressed
 				}
-				if keyIsReleased {
-					nes.controllerButtonReleased(keyScancode)
+				if keyIsPressed && t.Repeat == 0 {
+					switch keyScancode {
+					case sdl.SCANCODE_BACKSPACE:
+						isSlowMotion = !isSlowMotion
+					case sdl.SCANCODE_P:
+						isPaused = !isPaused
+					case sdl.SCANCODE_N:
+						isPaused = true
+						shouldAdvance = true
+					case sdl.SCANCODE_F11:
+						swapPort2(console)
+					case sdl.SCANCODE_F12:
+						port := 0
+						if t.Keysym.Mod&sdl.KMOD_SHIFT != 0 {
+							port += 1
+						}
+						if t.Keysym.Mod&sdl.KMOD_CTRL != 0 {
+							port += 2
+						}
+						mapper.startBinding(port)
+						sink.SetTitle(mapper.bindingPrompt())
+						log.Println(mapper.bindingPrompt())
+					}
+				}
+
+			case *sdl.MouseMotionEvent:
+				zapperX, zapperY = sink.screenPosition(t.X, t.Y)
+
+			case *sdl.MouseButtonEvent:
+				if t.Button == sdl.BUTTON_LEFT {
+					zapperX, zapperY = sink.screenPosition(t.X, t.Y)
+					isTriggerPulled = t.State == sdl.PRESSED
+				}
+
+			case *sdl.ControllerDeviceEvent:
+				if t.Type == sdl.CONTROLLERDEVICEADDED {
+					pads.added(int(t.Which))
+				} else if t.Type == sdl.CONTROLLERDEVICEREMOVED {
+					pads.removed(t.Which)
+				}
+
+			case *sdl.ControllerButtonEvent:
+				isPressed := t.State == sdl.PRESSED
+				pads.button(t.Which, t.Button, isPressed)
+				in := input{kind: inputButton, code: int(t.Button)}
+				if mapper.isBinding() && isPressed {
+					bindInput(mapper, &in, sink, inputPath)
+				} else if isPressed {
+					playMacros(console, mapper.macrosFor(in, mapper.padPort(t.Which)))
+				}
+
+			case *sdl.ControllerAxisEvent:
+				in, isPushed := mapper.axisPushed(t.Which, t.Axis, t.Value)
+				pads.axis(t.Which, t.Axis, t.Value)
+				if mapper.isBinding() && isPushed {
+					bindInput(mapper, &in, sink, inputPath)
+				} else if isPushed {
+					playMacros(console, mapper.macrosFor(in, mapper.padPort(t.Which)))
 				}
 
 			}
 		}
+		for port := 0; port < inputPorts; port++ {
+			buttons, turbo := mapper.buttons(port)
+			console.SetButtons(port, buttons)
+			console.SetTurboButtons(port, turbo)
+			console.AimZapper(port, zapperX, zapperY, isTriggerPulled)
+		}
+
+		pacer.wait(speed)
 	}
 }
 
-func (nes *NES) controllerButtonPressed(scancode sdl.Scancode) {
-	if scancode == sdl.SCANCODE_A {
-		nes.controller.pressButton(controllerButtonA)
-	} else if scancode == sdl.SCANCODE_B {
-		nes.controller.pressButton(controllerButtonB)
-	} else if scancode == sdl.SCANCODE_Z {
-		nes.controller.pressButton(controllerButtonSelect)					
-	} else if scancode == sdl.SCANCODE_X {
-		nes.controller.pressButton(controllerButtonStart)
-	} else if scancode == sdl.SCANCODE_UP {
-		nes.controller.pressButton(controllerButtonUp)
-	} else if scancode == sdl.SCANCODE_DOWN {
-		nes.controller.pressButton(controllerButtonDown)
-	} else if scancode == sdl.SCANCODE_LEFT {
-		nes.controller.pressButton(controllerButtonLeft)
-	} else if scancode == sdl.SCANCODE_RIGHT {
-		nes.controller.pressButton(controllerButtonRight)	
+//Moves the press-a-key-to-bind flow on, the bindings file is written after the last button
+func bindInput(mapper *inputMapper, in *input, sink *sdlFrameSink, inputPath string) {
+	if !mapper.bind(in) {
+		sink.SetTitle(mapper.bindingPrompt())
+		log.Println(mapper.bindingPrompt())
+		return
+	}
+
+	sink.SetTitle("")
+	err := saveInputConfig(inputPath, mapper.inputConfig())
+	if err != nil {
+		log.Println(err)
+		return
 	}
+	log.Printf("saved bindings to %v", inputPath)
 }
 
-func (nes *NES) controllerButtonReleased(scancode sdl.Scancode) {
-	if scancode == sdl.SCANCODE_A {
-		nes.controller.releaseButton(controllerButtonA)
-	} else if scancode == sdl.SCANCODE_B {
-		nes.controller.releaseButton(controllerButtonB)
-	} else if scancode == sdl.SCANCODE_Z {
-		nes.controller.releaseButton(controllerButtonSelect)					
-	} else if scancode == sdl.SCANCODE_X {
-		nes.controller.releaseButton(controllerButtonStart)
-	} else if scancode == sdl.SCANCODE_UP {
-		nes.controller.releaseButton(controllerButtonUp)
-	} else if scancode == sdl.SCANCODE_DOWN {
-		nes.controller.releaseButton(controllerButtonDown)
-	} else if scancode == sdl.SCANCODE_LEFT {
-		nes.controller.releaseButton(controllerButtonLeft)
-	} else if scancode == sdl.SCANCODE_RIGHT {
-		nes.controller.releaseButton(controllerButtonRight)	
+func playMacros(console *nes.NES, macros []portMacro) {
+	for _, macro := range macros {
+		console.PlayMacro(macro.port, macro.macro)
 	}
 }
 
-func drawFrame() {
-	texture.Update(nil, renderBuffer[:], windowWidth * argbBytes)
-	renderer.Clear()
-	renderer.Copy(texture, nil, nil)
-	renderer.Present()
+//F1-F9 load the numbered slot, Shift+F1-F9 save to it
+func stateHotkeyPressed(console *nes.NES, key sdl.Keysym, romPath string, saveDir string) {
+	if key.Scancode < sdl.SCANCODE_F1 || key.Scancode > sdl.SCANCODE_F9 {
+		return
+	}
+	slot := int(key.Scancode-sdl.SCANCODE_F1) + 1
+	path := nes.StatePath(romPath, saveDir, slot)
+
+	if key.Mod&sdl.KMOD_SHIFT != 0 {
+		err := console.SaveStateFile(path)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("saved state %v", slot)
+	} else {
+		err := console.LoadStateFile(path)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("loaded state %v", slot)
+	}
+}
+
+func queueAudio(samples []float32) {
+	if sdl.GetQueuedAudioSize(audioDevice) > maxQueuedAudioBytes {
+		return
+	}
+
+	data := make([]byte, 4*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(sample))
+	}
+	err := sdl.QueueAudio(audioDevice, data)
+	if err != nil {
+		log.Println(err)
+	}
 }
 
 func checkError(e error) {
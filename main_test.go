@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"nelr/nes"
+)
+
+func TestConnectDevices(t *testing.T) {
+	console := makeHeadlessTestNES(t)
+
+	err := connectDevices(console, "fourscore", [3]string{"", "zapper", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if console.Device(nes.Port1) == nes.PortDevice(console.Controller(0)) || console.Device(nes.Port2) != nes.PortDevice(console.Zapper(nes.Port2)) {
+		t.Errorf("the Four Score should stay on port 1 and the Zapper replace it on port 2")
+	}
+
+	swapPort2(console)
+	if console.Device(nes.Port2) != nes.PortDevice(console.Controller(1)) {
+		t.Errorf("F11 should put the controller back on port 2")
+	}
+
+	if err := connectDevices(console, "none", [3]string{"", "", "mouse"}); err == nil {
+		t.Errorf("unknown devices should be an error")
+	}
+	if err := connectDevices(console, "sixscore", [3]string{}); err == nil {
+		t.Errorf("unknown multitaps should be an error")
+	}
+}
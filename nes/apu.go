@@ -0,0 +1,333 @@
+package nes
+
+//2A03 APU
+//https://wiki.nesdev.com/w/index.php/APU
+type APU struct {
+	nes *NES
+
+	pulse1   Pulse
+	pulse2   Pulse
+	triangle Triangle
+	noise    Noise
+	dmc      DMC
+
+	cycles      uint64
+	frameCycles int
+	frameTiming *FrameCounterTiming
+	isFiveStepMode bool
+	isIRQInhibited bool
+	frameIRQPending bool
+	frameWriteDelay int
+	pendingFrameMode byte
+
+	sampleRate      float64
+	cyclesPerSample float64
+	sampleClock     float64
+	samples         []float32
+
+	highPassPrevIn  float32
+	highPassPrevOut float32
+	lowPassPrevOut  float32
+}
+
+const (
+	ntscCpuFrequency  = 1789773
+	palCpuFrequency   = 1662607
+	dendyCpuFrequency = 1773448
+	SampleRate     = 44100
+)
+
+//CPU cycles at which each frame sequencer step lands
+//https://wiki.nesdev.com/w/index.php/APU_Frame_Counter
+type FrameCounterTiming struct {
+	step1 int //quarter frame
+	step2 int //quarter and half frame
+	step3 int //quarter frame
+	step4 int //quarter and half frame in 4-step mode, nothing in 5-step mode
+	step5 int //quarter and half frame in 5-step mode
+}
+
+var frameCounterTimingNTSC = FrameCounterTiming{7457, 14913, 22371, 29829, 37281}
+var frameCounterTimingPAL = FrameCounterTiming{8313, 16627, 24939, 33253, 41565}
+
+//https://wiki.nesdev.com/w/index.php/APU_Length_Counter
+var lengthTable = [32]byte{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+func MakeNewAPU(nes *NES) *APU {
+	apu := APU{nes: nes}
+	apu.pulse1.isFirstChannel = true
+	apu.noise.shiftRegister = 1
+	apu.noise.periodTable = &noisePeriodTableNTSC
+	apu.dmc.rateTable = &dmcRateTableNTSC
+	apu.dmc.apu = &apu
+
+	apu.frameTiming = &frameCounterTimingNTSC
+
+	cpuFrequency := float64(ntscCpuFrequency)
+	switch nes.cart.getTimingMode() {
+	case timingPAL:
+		cpuFrequency = palCpuFrequency
+		apu.frameTiming = &frameCounterTimingPAL
+		apu.noise.periodTable = &noisePeriodTablePAL
+		apu.dmc.rateTable = &dmcRateTablePAL
+	case timingDendy:
+		cpuFrequency = dendyCpuFrequency
+	}
+	apu.noise.period = apu.noise.periodTable[0]
+	apu.dmc.period = apu.dmc.rateTable[0]
+	apu.dmc.writeRegister(2, 0x00)
+	apu.dmc.writeRegister(3, 0x00)
+	apu.sampleRate = SampleRate
+	apu.cyclesPerSample = cpuFrequency / apu.sampleRate
+
+	return &apu
+}
+
+//Clocked once per CPU cycle
+func (apu *APU) Step() {
+	apu.cycles++
+
+	//Pulse timers tick every other CPU cycle, noise and DMC periods are in CPU cycles
+	if apu.cycles%2 == 0 {
+		apu.pulse1.clockTimer()
+		apu.pulse2.clockTimer()
+	}
+	apu.triangle.clockTimer()
+	apu.noise.clockTimer()
+	apu.dmc.clockTimer()
+
+	apu.stepFrameSequencer()
+
+	apu.sampleClock++
+	if apu.sampleClock >= apu.cyclesPerSample {
+		apu.sampleClock -= apu.cyclesPerSample
+		apu.samples = append(apu.samples, apu.filter(apu.output()))
+	}
+}
+
+func (apu *APU) stepFrameSequencer() {
+	//$4017 writes take effect 3 or 4 CPU cycles later
+	if apu.frameWriteDelay > 0 {
+		apu.frameWriteDelay--
+		if apu.frameWriteDelay == 0 {
+			apu.resetFrameSequencer()
+			return
+		}
+	}
+
+	apu.frameCycles++
+	timing := apu.frameTiming
+	switch apu.frameCycles {
+	case timing.step1, timing.step3:
+		apu.clockQuarterFrame()
+	case timing.step2:
+		apu.clockQuarterFrame()
+		apu.clockHalfFrame()
+	case timing.step4 - 1:
+		apu.setFrameIRQ()
+	case timing.step4:
+		if !apu.isFiveStepMode {
+			apu.clockQuarterFrame()
+			apu.clockHalfFrame()
+			apu.setFrameIRQ()
+		}
+	case timing.step4 + 1:
+		if !apu.isFiveStepMode {
+			apu.setFrameIRQ()
+			apu.frameCycles = 0
+		}
+	case timing.step5:
+		apu.clockQuarterFrame()
+		apu.clockHalfFrame()
+	case timing.step5 + 1:
+		apu.frameCycles = 0
+	}
+}
+
+//Only the 4-step sequence raises the frame interrupt
+func (apu *APU) setFrameIRQ() {
+	if apu.isFiveStepMode || apu.isIRQInhibited {
+		return
+	}
+	apu.frameIRQPending = true
+	apu.nes.cpu.assertIRQ(irqSourceFrameCounter)
+}
+
+func (apu *APU) clearFrameIRQ() {
+	apu.frameIRQPending = false
+	apu.nes.cpu.acknowledgeIRQ(irqSourceFrameCounter)
+}
+
+//MI-- ----
+func (apu *APU) writeFrameCounter(value byte) {
+	apu.isIRQInhibited = value&0x40 != 0
+	if apu.isIRQInhibited {
+		apu.clearFrameIRQ()
+	}
+
+	apu.pendingFrameMode = value
+	if apu.cycles%2 == 0 { //during an APU cycle
+		apu.frameWriteDelay = 3
+	} else {
+		apu.frameWriteDelay = 4
+	}
+}
+
+func (apu *APU) resetFrameSequencer() {
+	apu.frameCycles = 0
+	apu.isFiveStepMode = apu.pendingFrameMode&0x80 != 0
+	if apu.isFiveStepMode {
+		apu.clockQuarterFrame()
+		apu.clockHalfFrame()
+	}
+}
+
+//Channels are silenced and the frame counter restarts with the last $4017 value
+func (apu *APU) reset() {
+	apu.writeControl(0x00)
+	apu.triangle.sequence = 0
+	apu.dmc.outputLevel &= 1
+	apu.writeFrameCounter(apu.pendingFrameMode)
+}
+
+//Envelopes and the triangle's linear counter
+func (apu *APU) clockQuarterFrame() {
+	apu.pulse1.envelope.clock()
+	apu.pulse2.envelope.clock()
+	apu.noise.envelope.clock()
+	apu.triangle.clockLinearCounter()
+}
+
+//Length counters and sweep units
+func (apu *APU) clockHalfFrame() {
+	apu.pulse1.clockLength()
+	apu.pulse2.clockLength()
+	apu.triangle.clockLength()
+	apu.noise.clockLength()
+	apu.pulse1.clockSweep()
+	apu.pulse2.clockSweep()
+}
+
+//https://wiki.nesdev.com/w/index.php/APU_Mixer
+func (apu *APU) output() float32 {
+	p := float32(apu.pulse1.output() + apu.pulse2.output())
+	var pulseOut float32
+	if p > 0 {
+		pulseOut = 95.88 / (8128/p + 100)
+	}
+
+	t := float32(apu.triangle.output())
+	n := float32(apu.noise.output())
+	d := float32(apu.dmc.output())
+	var tndOut float32
+	if t+n+d > 0 {
+		tndOut = 159.79 / (1/(t/8227+n/12241+d/22638) + 100)
+	}
+
+	return pulseOut + tndOut
+}
+
+//First-order 90Hz high-pass and 14kHz low-pass, as on the console output
+func (apu *APU) filter(sample float32) float32 {
+	const highPass = 0.987 //exp(-2pi*90/44100)
+	const lowPass = 0.864  //1-exp(-2pi*14000/44100)
+
+	out := highPass * (apu.highPassPrevOut + sample - apu.highPassPrevIn)
+	apu.highPassPrevIn = sample
+	apu.highPassPrevOut = out
+
+	apu.lowPassPrevOut += lowPass * (out - apu.lowPassPrevOut)
+	return apu.lowPassPrevOut
+}
+
+//Samples produced since the last call, in the range -1 to 1
+func (apu *APU) TakeSamples() []float32 {
+	samples := apu.samples
+	apu.samples = nil
+	return samples
+}
+
+func (apu *APU) WriteRegister(addr uint16, value byte) {
+	switch {
+	case addr < 0x4004:
+		apu.pulse1.writeRegister(addr-0x4000, value)
+	case addr < 0x4008:
+		apu.pulse2.writeRegister(addr-0x4004, value)
+	case addr < 0x400C:
+		apu.triangle.writeRegister(addr-0x4008, value)
+	case addr < 0x4010:
+		apu.noise.writeRegister(addr-0x400C, value)
+	case addr < 0x4014:
+		apu.dmc.writeRegister(addr-0x4010, value)
+	case addr == 0x4015:
+		apu.writeControl(value)
+	case addr == 0x4017:
+		apu.writeFrameCounter(value)
+	}
+}
+
+//---D NT21
+func (apu *APU) writeControl(value byte) {
+	apu.pulse1.setEnabled(value&0x01 != 0)
+	apu.pulse2.setEnabled(value&0x02 != 0)
+	apu.triangle.setEnabled(value&0x04 != 0)
+	apu.noise.setEnabled(value&0x08 != 0)
+	apu.dmc.setEnabled(value&0x10 != 0)
+}
+
+//IF-D NT21, reading clears the frame interrupt flag
+func (apu *APU) ReadStatus() byte {
+	var status byte
+	if apu.pulse1.lengthCounter > 0 {
+		status |= 0x01
+	}
+	if apu.pulse2.lengthCounter > 0 {
+		status |= 0x02
+	}
+	if apu.triangle.lengthCounter > 0 {
+		status |= 0x04
+	}
+	if apu.noise.lengthCounter > 0 {
+		status |= 0x08
+	}
+	if apu.dmc.bytesRemaining > 0 {
+		status |= 0x10
+	}
+	if apu.frameIRQPending {
+		status |= 0x40
+	}
+	if apu.dmc.irqPending {
+		status |= 0x80
+	}
+	apu.clearFrameIRQ()
+	return status
+}
+
+//Queued samples and the output filters are not saved, audio just resumes from silence
+func (apu *APU) saveState(s *stateWriter) {
+	apu.pulse1.saveState(s)
+	apu.pulse2.saveState(s)
+	apu.triangle.saveState(s)
+	apu.noise.saveState(s)
+	apu.dmc.saveState(s)
+
+	s.write(apu.cycles, apu.isFiveStepMode, apu.isIRQInhibited, apu.frameIRQPending,
+		apu.pendingFrameMode, apu.sampleClock)
+	s.writeInt(apu.frameCycles, apu.frameWriteDelay)
+}
+
+func (apu *APU) loadState(s *stateReader) {
+	apu.pulse1.loadState(s)
+	apu.pulse2.loadState(s)
+	apu.triangle.loadState(s)
+	apu.noise.loadState(s)
+	apu.dmc.loadState(s)
+
+	s.read(&apu.cycles, &apu.isFiveStepMode, &apu.isIRQInhibited, &apu.frameIRQPending,
+		&apu.pendingFrameMode, &apu.sampleClock)
+	s.readInt(&apu.frameCycles, &apu.frameWriteDelay)
+	apu.samples = nil
+}
@@ -0,0 +1,504 @@
+package nes
+
+//https://wiki.nesdev.com/w/index.php/APU_Envelope
+type Envelope struct {
+	start    bool
+	loop     bool
+	constant bool
+	period   byte
+	divider  byte
+	decay    byte
+}
+
+func (e *Envelope) clock() {
+	if e.start {
+		e.start = false
+		e.decay = 15
+		e.divider = e.period
+		return
+	}
+
+	if e.divider > 0 {
+		e.divider--
+		return
+	}
+	e.divider = e.period
+	if e.decay > 0 {
+		e.decay--
+	} else if e.loop {
+		e.decay = 15
+	}
+}
+
+func (e *Envelope) volume() byte {
+	if e.constant {
+		return e.period
+	}
+	return e.decay
+}
+
+//https://wiki.nesdev.com/w/index.php/APU_Pulse
+type Pulse struct {
+	isFirstChannel bool //pulse 1 negates with one's complement
+	enabled        bool
+
+	duty      byte
+	dutyStep  byte
+	timer     uint16
+	period    uint16
+	envelope  Envelope
+
+	lengthCounter byte
+	lengthHalt    bool
+
+	sweepEnabled bool
+	sweepPeriod  byte
+	sweepNegate  bool
+	sweepShift   byte
+	sweepDivider byte
+	sweepReload  bool
+}
+
+var pulseDutyTable = [4][8]byte{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+func (p *Pulse) writeRegister(reg uint16, value byte) {
+	switch reg {
+	case 0: //DDLC VVVV
+		p.duty = value >> 6
+		p.lengthHalt = value&0x20 != 0
+		p.envelope.loop = p.lengthHalt
+		p.envelope.constant = value&0x10 != 0
+		p.envelope.period = value & 0x0F
+	case 1: //EPPP NSSS
+		p.sweepEnabled = value&0x80 != 0
+		p.sweepPeriod = (value >> 4) & 7
+		p.sweepNegate = value&0x08 != 0
+		p.sweepShift = value & 7
+		p.sweepReload = true
+	case 2:
+		p.period = (p.period & 0x0700) | uint16(value)
+	case 3: //LLLL LHHH
+		p.period = (p.period & 0x00FF) | uint16(value&7)<<8
+		if p.enabled {
+			p.lengthCounter = lengthTable[value>>3]
+		}
+		p.envelope.start = true
+		p.dutyStep = 0
+	}
+}
+
+func (p *Pulse) setEnabled(enabled bool) {
+	p.enabled = enabled
+	if !enabled {
+		p.lengthCounter = 0
+	}
+}
+
+func (p *Pulse) clockTimer() {
+	if p.timer == 0 {
+		p.timer = p.period
+		p.dutyStep = (p.dutyStep + 1) % 8
+	} else {
+		p.timer--
+	}
+}
+
+func (p *Pulse) clockLength() {
+	if p.lengthCounter > 0 && !p.lengthHalt {
+		p.lengthCounter--
+	}
+}
+
+//https://wiki.nesdev.com/w/index.php/APU_Sweep
+func (p *Pulse) sweepTarget() uint16 {
+	change := p.period >> p.sweepShift
+	if !p.sweepNegate {
+		return p.period + change
+	}
+	if p.isFirstChannel {
+		change++
+	}
+	if change > p.period {
+		return 0
+	}
+	return p.period - change
+}
+
+func (p *Pulse) isSweepMuting() bool {
+	return p.period < 8 || p.sweepTarget() > 0x7FF
+}
+
+func (p *Pulse) clockSweep() {
+	if p.sweepDivider == 0 && p.sweepEnabled && p.sweepShift > 0 && !p.isSweepMuting() {
+		p.period = p.sweepTarget()
+	}
+	if p.sweepDivider == 0 || p.sweepReload {
+		p.sweepDivider = p.sweepPeriod
+		p.sweepReload = false
+	} else {
+		p.sweepDivider--
+	}
+}
+
+func (p *Pulse) output() byte {
+	if p.lengthCounter == 0 || p.isSweepMuting() || pulseDutyTable[p.duty][p.dutyStep] == 0 {
+		return 0
+	}
+	return p.envelope.volume()
+}
+
+//https://wiki.nesdev.com/w/index.php/APU_Triangle
+type Triangle struct {
+	enabled bool
+
+	timer    uint16
+	period   uint16
+	sequence byte
+
+	lengthCounter byte
+	control       bool //also halts the length counter
+
+	linearCounter byte
+	linearPeriod  byte
+	linearReload  bool
+}
+
+var triangleTable = [32]byte{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+func (t *Triangle) writeRegister(reg uint16, value byte) {
+	switch reg {
+	case 0: //CRRR RRRR
+		t.control = value&0x80 != 0
+		t.linearPeriod = value & 0x7F
+	case 2:
+		t.period = (t.period & 0x0700) | uint16(value)
+	case 3:
+		t.period = (t.period & 0x00FF) | uint16(value&7)<<8
+		if t.enabled {
+			t.lengthCounter = lengthTable[value>>3]
+		}
+		t.linearReload = true
+	}
+}
+
+func (t *Triangle) setEnabled(enabled bool) {
+	t.enabled = enabled
+	if !enabled {
+		t.lengthCounter = 0
+	}
+}
+
+func (t *Triangle) clockTimer() {
+	if t.timer > 0 {
+		t.timer--
+		return
+	}
+	t.timer = t.period
+	//Ultrasonic periods hold the sequencer instead of producing a pop
+	if t.lengthCounter > 0 && t.linearCounter > 0 && t.period >= 2 {
+		t.sequence = (t.sequence + 1) % 32
+	}
+}
+
+func (t *Triangle) clockLinearCounter() {
+	if t.linearReload {
+		t.linearCounter = t.linearPeriod
+	} else if t.linearCounter > 0 {
+		t.linearCounter--
+	}
+	if !t.control {
+		t.linearReload = false
+	}
+}
+
+func (t *Triangle) clockLength() {
+	if t.lengthCounter > 0 && !t.control {
+		t.lengthCounter--
+	}
+}
+
+func (t *Triangle) output() byte {
+	return triangleTable[t.sequence]
+}
+
+//https://wiki.nesdev.com/w/index.php/APU_Noise
+type Noise struct {
+	enabled bool
+
+	mode          bool
+	shiftRegister uint16
+	timer         uint16
+	period        uint16
+	periodTable   *[16]uint16
+	envelope      Envelope
+
+	lengthCounter byte
+	lengthHalt    bool
+}
+
+//Periods in CPU cycles
+var noisePeriodTableNTSC = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+
+var noisePeriodTablePAL = [16]uint16{
+	4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778,
+}
+
+func (n *Noise) writeRegister(reg uint16, value byte) {
+	switch reg {
+	case 0: //--LC VVVV
+		n.lengthHalt = value&0x20 != 0
+		n.envelope.loop = n.lengthHalt
+		n.envelope.constant = value&0x10 != 0
+		n.envelope.period = value & 0x0F
+	case 2: //M--- PPPP
+		n.mode = value&0x80 != 0
+		n.period = n.periodTable[value&0x0F]
+	case 3:
+		if n.enabled {
+			n.lengthCounter = lengthTable[value>>3]
+		}
+		n.envelope.start = true
+	}
+}
+
+func (n *Noise) setEnabled(enabled bool) {
+	n.enabled = enabled
+	if !enabled {
+		n.lengthCounter = 0
+	}
+}
+
+func (n *Noise) clockTimer() {
+	if n.timer > 0 {
+		n.timer--
+		return
+	}
+	//Periods are in CPU cycles like the DMC rates, counting down to 0 takes period-1 more
+	n.timer = n.period - 1
+
+	//Mode 1 taps bit 6 for the short 93-step sequence
+	tap := uint16(1)
+	if n.mode {
+		tap = 6
+	}
+	feedback := (n.shiftRegister & 1) ^ ((n.shiftRegister >> tap) & 1)
+	n.shiftRegister = (n.shiftRegister >> 1) | (feedback << 14)
+}
+
+func (n *Noise) clockLength() {
+	if n.lengthCounter > 0 && !n.lengthHalt {
+		n.lengthCounter--
+	}
+}
+
+func (n *Noise) output() byte {
+	if n.lengthCounter == 0 || n.shiftRegister&1 == 1 {
+		return 0
+	}
+	return n.envelope.volume()
+}
+
+//https://wiki.nesdev.com/w/index.php/APU_DMC
+type DMC struct {
+	apu *APU
+
+	irqEnabled bool
+	irqPending bool
+	loop       bool
+	timer      uint16
+	period     uint16
+	rateTable  *[16]uint16
+
+	outputLevel byte
+
+	sampleAddress  uint16
+	sampleLength   uint16
+	currentAddress uint16
+	bytesRemaining uint16
+
+	sampleBuffer      byte
+	isSampleBufferFull bool
+
+	shiftRegister byte
+	bitsRemaining byte
+	silence       bool
+}
+
+//Rates in CPU cycles
+var dmcRateTableNTSC = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+
+var dmcRateTablePAL = [16]uint16{
+	398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50,
+}
+
+func (d *DMC) writeRegister(reg uint16, value byte) {
+	switch reg {
+	case 0: //IL-- RRRR
+		d.irqEnabled = value&0x80 != 0
+		d.loop = value&0x40 != 0
+		d.period = d.rateTable[value&0x0F]
+		if !d.irqEnabled {
+			d.irqPending = false
+			d.apu.nes.cpu.acknowledgeIRQ(irqSourceDMC)
+		}
+	case 1: //-DDD DDDD
+		d.outputLevel = value & 0x7F
+	case 2: //$C000 + A*64
+		d.sampleAddress = 0xC000 | uint16(value)<<6
+	case 3: //L*16 + 1 bytes
+		d.sampleLength = uint16(value)<<4 | 1
+	}
+}
+
+func (d *DMC) setEnabled(enabled bool) {
+	d.irqPending = false
+	d.apu.nes.cpu.acknowledgeIRQ(irqSourceDMC)
+
+	if !enabled {
+		d.bytesRemaining = 0
+	} else if d.bytesRemaining == 0 {
+		d.restart()
+	}
+}
+
+func (d *DMC) restart() {
+	d.currentAddress = d.sampleAddress
+	d.bytesRemaining = d.sampleLength
+}
+
+func (d *DMC) clockTimer() {
+	d.fetchSample()
+
+	if d.timer > 0 {
+		d.timer--
+		return
+	}
+	d.timer = d.period - 1
+	d.clockOutput()
+}
+
+//The memory reader steals CPU cycles whenever the sample buffer empties
+func (d *DMC) fetchSample() {
+	if d.isSampleBufferFull || d.bytesRemaining == 0 {
+		return
+	}
+
+	cpu := d.apu.nes.cpu
+	cpu.suspendCycles += 4
+	d.sampleBuffer = d.apu.nes.Read(d.currentAddress)
+	d.isSampleBufferFull = true
+
+	d.currentAddress++
+	if d.currentAddress == 0 {
+		d.currentAddress = 0x8000
+	}
+	d.bytesRemaining--
+	if d.bytesRemaining > 0 {
+		return
+	}
+	if d.loop {
+		d.restart()
+	} else if d.irqEnabled {
+		d.irqPending = true
+		cpu.assertIRQ(irqSourceDMC)
+	}
+}
+
+func (d *DMC) clockOutput() {
+	if !d.silence {
+		if d.shiftRegister&1 == 1 {
+			if d.outputLevel <= 125 {
+				d.outputLevel += 2
+			}
+		} else if d.outputLevel >= 2 {
+			d.outputLevel -= 2
+		}
+	}
+	d.shiftRegister >>= 1
+
+	if d.bitsRemaining > 0 {
+		d.bitsRemaining--
+	}
+	if d.bitsRemaining > 0 {
+		return
+	}
+
+	//Start a new output cycle
+	d.bitsRemaining = 8
+	if d.isSampleBufferFull {
+		d.silence = false
+		d.shiftRegister = d.sampleBuffer
+		d.isSampleBufferFull = false
+	} else {
+		d.silence = true
+	}
+}
+
+func (d *DMC) output() byte {
+	return d.outputLevel
+}
+
+func (e *Envelope) saveState(s *stateWriter) {
+	s.write(e.start, e.loop, e.constant, e.period, e.divider, e.decay)
+}
+
+func (e *Envelope) loadState(s *stateReader) {
+	s.read(&e.start, &e.loop, &e.constant, &e.period, &e.divider, &e.decay)
+}
+
+func (p *Pulse) saveState(s *stateWriter) {
+	s.write(p.enabled, p.duty, p.dutyStep, p.timer, p.period, p.lengthCounter, p.lengthHalt,
+		p.sweepEnabled, p.sweepPeriod, p.sweepNegate, p.sweepShift, p.sweepDivider, p.sweepReload)
+	p.envelope.saveState(s)
+}
+
+func (p *Pulse) loadState(s *stateReader) {
+	s.read(&p.enabled, &p.duty, &p.dutyStep, &p.timer, &p.period, &p.lengthCounter, &p.lengthHalt,
+		&p.sweepEnabled, &p.sweepPeriod, &p.sweepNegate, &p.sweepShift, &p.sweepDivider, &p.sweepReload)
+	p.envelope.loadState(s)
+}
+
+func (t *Triangle) saveState(s *stateWriter) {
+	s.write(t.enabled, t.timer, t.period, t.sequence, t.lengthCounter, t.control,
+		t.linearCounter, t.linearPeriod, t.linearReload)
+}
+
+func (t *Triangle) loadState(s *stateReader) {
+	s.read(&t.enabled, &t.timer, &t.period, &t.sequence, &t.lengthCounter, &t.control,
+		&t.linearCounter, &t.linearPeriod, &t.linearReload)
+}
+
+//The period table is fixed by the region, only the selected period is state
+func (n *Noise) saveState(s *stateWriter) {
+	s.write(n.enabled, n.mode, n.shiftRegister, n.timer, n.period, n.lengthCounter, n.lengthHalt)
+	n.envelope.saveState(s)
+}
+
+func (n *Noise) loadState(s *stateReader) {
+	s.read(&n.enabled, &n.mode, &n.shiftRegister, &n.timer, &n.period, &n.lengthCounter, &n.lengthHalt)
+	n.envelope.loadState(s)
+}
+
+func (d *DMC) saveState(s *stateWriter) {
+	s.write(d.irqEnabled, d.irqPending, d.loop, d.timer, d.period, d.outputLevel,
+		d.sampleAddress, d.sampleLength, d.currentAddress, d.bytesRemaining,
+		d.sampleBuffer, d.isSampleBufferFull, d.shiftRegister, d.bitsRemaining, d.silence)
+}
+
+func (d *DMC) loadState(s *stateReader) {
+	s.read(&d.irqEnabled, &d.irqPending, &d.loop, &d.timer, &d.period, &d.outputLevel,
+		&d.sampleAddress, &d.sampleLength, &d.currentAddress, &d.bytesRemaining,
+		&d.sampleBuffer, &d.isSampleBufferFull, &d.shiftRegister, &d.bitsRemaining, &d.silence)
+}
@@ -0,0 +1,234 @@
+package nes
+
+import (
+	"testing"
+)
+
+func stepAPU(nes *NES, cycles int) {
+	for i := 0; i < cycles; i++ {
+		nes.apu.Step()
+	}
+}
+
+func TestAPULengthCounterStatus(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 2, 1))
+
+	//Length loads are ignored while the channel is disabled
+	nes.Write(0x4003, 0x08)
+	if got := nes.Read(0x4015); got&0x01 != 0 {
+		t.Errorf("disabled pulse 1 should not load its length counter")
+	}
+
+	nes.Write(0x4015, 0x0F)
+	nes.Write(0x4003, 0x18) //length index 3 = 2
+	nes.Write(0x400B, 0x08)
+	nes.Write(0x400F, 0x08)
+	if got := nes.Read(0x4015); got&0x0F != 0x0D {
+		t.Errorf("expected pulse 1, triangle and noise active, got $%X", got)
+	}
+
+	//Two half frames run the pulse's length counter out
+	stepAPU(nes, 29830)
+	if got := nes.Read(0x4015); got&0x01 != 0 {
+		t.Errorf("pulse 1 length counter should have expired, status $%X", got)
+	}
+
+	nes.Write(0x4015, 0x00)
+	if got := nes.Read(0x4015); got&0x1F != 0 {
+		t.Errorf("disabling channels should clear length counters, status $%X", got)
+	}
+}
+
+func TestPulseSweepMuting(t *testing.T) {
+	p := Pulse{isFirstChannel: true}
+
+	p.period = 7
+	if !p.isSweepMuting() {
+		t.Errorf("periods below 8 should mute")
+	}
+
+	p.period = 0x700
+	p.sweepShift = 1
+	if !p.isSweepMuting() {
+		t.Errorf("sweep target above $7FF should mute even when disabled")
+	}
+
+	//Pulse 1 subtracts an extra 1
+	p.period = 0x100
+	p.sweepNegate = true
+	if got := p.sweepTarget(); got != 0x7F {
+		t.Errorf("pulse 1 negate: expected $7F, got $%X", got)
+	}
+	p.isFirstChannel = false
+	if got := p.sweepTarget(); got != 0x80 {
+		t.Errorf("pulse 2 negate: expected $80, got $%X", got)
+	}
+}
+
+func TestEnvelopeDecay(t *testing.T) {
+	e := Envelope{start: true, period: 0}
+	e.clock()
+	if got := e.volume(); got != 15 {
+		t.Errorf("start flag should reload decay to 15, got %v", got)
+	}
+	for i := 0; i < 15; i++ {
+		e.clock()
+	}
+	if got := e.volume(); got != 0 {
+		t.Errorf("expected decay to reach 0, got %v", got)
+	}
+
+	e.loop = true
+	e.clock()
+	if got := e.volume(); got != 15 {
+		t.Errorf("looping envelope should wrap to 15, got %v", got)
+	}
+}
+
+func TestNoiseTimerPeriod(t *testing.T) {
+	n := Noise{shiftRegister: 1, periodTable: &noisePeriodTableNTSC, period: 4}
+
+	shifts := 0
+	for i := 0; i < 40; i++ {
+		register := n.shiftRegister
+		n.clockTimer()
+		if n.shiftRegister != register {
+			shifts++
+		}
+	}
+	if shifts != 10 {
+		t.Errorf("expected a shift every 4 CPU cycles, got %v in 40", shifts)
+	}
+}
+
+func TestNoiseShortMode(t *testing.T) {
+	n := Noise{shiftRegister: 1, mode: true, periodTable: &noisePeriodTableNTSC, period: 1}
+
+	//Mode 1 repeats every 93 or 31 steps depending on the seed
+	seen := map[uint16]int{}
+	for i := 0; i < 200; i++ {
+		if first, ok := seen[n.shiftRegister]; ok {
+			if period := i - first; period != 93 && period != 31 {
+				t.Errorf("unexpected short mode period %v", period)
+			}
+			return
+		}
+		seen[n.shiftRegister] = i
+		n.clockTimer()
+	}
+	t.Errorf("short mode sequence did not repeat")
+}
+
+func TestDMCSampleFetchAndIRQ(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 2, 1))
+
+	nes.Write(0x4010, 0x8F) //IRQ, fastest rate
+	nes.Write(0x4012, 0x00) //$C000
+	nes.Write(0x4013, 0x00) //1 byte
+	nes.Write(0x4015, 0x10)
+	if got := nes.Read(0x4015); got&0x10 == 0 {
+		t.Errorf("DMC should report bytes remaining")
+	}
+
+	suspended := nes.cpu.suspendCycles
+	nes.apu.Step()
+	if nes.cpu.suspendCycles != suspended+4 {
+		t.Errorf("sample fetch should steal 4 CPU cycles")
+	}
+	if got := nes.Read(0x4015); got&0x90 != 0x80 {
+		t.Errorf("expected DMC IRQ after the last byte, status $%X", got)
+	}
+	if nes.cpu.irqLine&irqSourceDMC == 0 {
+		t.Errorf("DMC IRQ should assert the CPU IRQ line")
+	}
+
+	nes.Write(0x4015, 0x00)
+	if nes.cpu.irqLine&irqSourceDMC != 0 {
+		t.Errorf("$4015 write should acknowledge the DMC IRQ")
+	}
+}
+
+func TestAPUSampleRate(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 2, 1))
+
+	stepAPU(nes, ntscCpuFrequency)
+	samples := nes.apu.TakeSamples()
+	if len(samples) < SampleRate-1 || len(samples) > SampleRate+1 {
+		t.Errorf("expected %v samples for one second, got %v", SampleRate, len(samples))
+	}
+	if len(nes.apu.TakeSamples()) != 0 {
+		t.Errorf("taking samples should drain the buffer")
+	}
+}
+
+func TestFrameCounterIRQ(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 2, 1))
+
+	stepAPU(nes, frameCounterTimingNTSC.step4-2)
+	if nes.apu.frameIRQPending {
+		t.Errorf("frame IRQ raised too early")
+	}
+	stepAPU(nes, 1)
+	if !nes.apu.frameIRQPending || nes.cpu.irqLine&irqSourceFrameCounter == 0 {
+		t.Errorf("expected frame IRQ at cycle %v", frameCounterTimingNTSC.step4-1)
+	}
+
+	if got := nes.Read(0x4015); got&0x40 == 0 {
+		t.Errorf("status should report the frame IRQ, got $%X", got)
+	}
+	if nes.apu.frameIRQPending || nes.cpu.irqLine != 0 {
+		t.Errorf("reading $4015 should clear the frame IRQ")
+	}
+}
+
+func TestFrameCounterInhibitAndFiveStepMode(t *testing.T) {
+	for _, value := range []byte{0x40, 0x80} {
+		nes := makeTestNES(makeTestCartridge(0, 2, 1))
+		nes.Write(0x4017, value)
+
+		stepAPU(nes, 2*frameCounterTimingNTSC.step5)
+		if nes.apu.frameIRQPending || nes.cpu.irqLine != 0 {
+			t.Errorf("$4017=$%X should not raise a frame IRQ", value)
+		}
+	}
+}
+
+func TestFrameCounterWriteDelay(t *testing.T) {
+	for _, test := range []struct {
+		oddCycle bool
+		delay    int
+	}{{false, 3}, {true, 4}} {
+		nes := makeTestNES(makeTestCartridge(0, 2, 1))
+		if test.oddCycle {
+			stepAPU(nes, 1)
+		}
+		nes.Write(0x4015, 0x01)
+		nes.Write(0x4003, 0x18) //length 2
+
+		//5-step mode clocks a half frame as soon as the write lands
+		nes.Write(0x4017, 0x80)
+		stepAPU(nes, test.delay-1)
+		if nes.apu.pulse1.lengthCounter != 2 {
+			t.Errorf("delay %v: $4017 write took effect too early", test.delay)
+		}
+		stepAPU(nes, 1)
+		if nes.apu.pulse1.lengthCounter != 1 {
+			t.Errorf("delay %v: expected an immediate half frame clock", test.delay)
+		}
+	}
+}
+
+func TestFrameCounterPALTiming(t *testing.T) {
+	cart := makeTestCartridge(0, 2, 1)
+	cart.header.Flag9 = 0x01
+	nes := makeTestNES(cart)
+
+	stepAPU(nes, frameCounterTimingNTSC.step4+1)
+	if nes.apu.frameIRQPending {
+		t.Errorf("PAL frame IRQ should not use NTSC timing")
+	}
+	stepAPU(nes, frameCounterTimingPAL.step4-frameCounterTimingNTSC.step4-2)
+	if !nes.apu.frameIRQPending {
+		t.Errorf("expected PAL frame IRQ at cycle %v", frameCounterTimingPAL.step4-1)
+	}
+}
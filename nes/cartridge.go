@@ -0,0 +1,331 @@
+package nes
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"errors"
+	"fmt"
+	"encoding/binary"
+)
+
+const iNESMagicNumber = 0x1A53454E
+
+var (
+	ErrBadMagic         = errors.New("not an iNES rom")
+	ErrTruncatedRom     = errors.New("rom is truncated")
+	ErrUnsupportedMapper = errors.New("mapper not supported")
+	ErrRomTooLarge      = errors.New("rom section is too large")
+)
+
+//Larger than any real board, a bigger header size is a broken rom
+const maxRomSectionSize = 64 << 20
+
+//https://wiki.nesdev.com/w/index.php/INES
+//https://wiki.nesdev.com/w/index.php/NES_2.0
+type INESHeader struct {
+	MagicNumber uint32
+	PrgRomSize  byte
+	ChrRomSize  byte
+	Flag6       byte
+	Flag7       byte
+	Flag8       byte //iNES: PRG RAM size, NES 2.0: mapper MSB and submapper
+	Flag9       byte //iNES: TV system, NES 2.0: PRG/CHR ROM size MSB
+	Flag10      byte //NES 2.0: PRG RAM/NVRAM shift counts
+	Flag11      byte //NES 2.0: CHR RAM/NVRAM shift counts
+	Flag12      byte //NES 2.0: CPU/PPU timing
+	Flag13      byte //NES 2.0: Vs. System or extended console type
+	Flag14      byte //NES 2.0: miscellaneous ROMs
+	Flag15      byte //NES 2.0: default expansion device
+}
+
+//CPU/PPU timing
+const (
+	timingNTSC = 0
+	timingPAL = 1
+	timingMultiRegion = 2
+	timingDendy = 3
+)
+
+//Console type
+const (
+	consoleNES = 0
+	consoleVsSystem = 1
+	consolePlayChoice = 2
+	consoleExtended = 3
+)
+
+type Cartridge struct {
+	header  INESHeader
+	trainer []byte
+	prg []byte
+	chr []byte
+	hasChrRam bool
+	wram []byte //PRG RAM and NVRAM sized from the header
+	isWramDirty bool //unsaved writes to battery-backed wram
+	vram [0x800]byte //Extra nametables on four-screen boards
+}
+
+func LoadRom(path string) (Cartridge, error) {
+	var err error
+	var rom *os.File
+	rom, err = os.Open(path)
+	if err != nil {
+		return Cartridge{}, err
+	}
+	defer rom.Close()
+
+	return ReadRom(rom)
+}
+
+//Fails with ErrBadMagic, ErrTruncatedRom or ErrRomTooLarge
+func ReadRom(rom io.Reader) (Cartridge, error) {
+	header := INESHeader{}
+	err := binary.Read(rom, binary.LittleEndian, &header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return Cartridge{}, fmt.Errorf("%w: header", ErrTruncatedRom)
+	}
+	if err != nil {
+		return Cartridge{}, err
+	}
+
+	if header.MagicNumber != iNESMagicNumber {
+		return Cartridge{}, ErrBadMagic
+	}
+
+	cartridge := Cartridge{header: header}
+
+	var trainerSize int
+	if header.Flag6&0x4 > 0 {
+		trainerSize = 512
+	} else {
+		trainerSize = 0
+	}
+	cartridge.trainer, err = readNextNBytes(rom, trainerSize, "trainer")
+	if err != nil {
+		return Cartridge{}, err
+	}
+	cartridge.prg, err = readNextNBytes(rom, cartridge.getPrgRomSize(), "PRG ROM")
+	if err != nil {
+		return Cartridge{}, err
+	}
+	//Mappers index PRG ROM modulo its size, so it can't be empty or shorter than the fixed bank
+	prgSize := len(cartridge.prg)
+	if prgSize == 0 || prgSize < boardFixedPrgWindow[cartridge.getMapperId()] {
+		return Cartridge{}, fmt.Errorf("%w: PRG ROM has %v bytes", ErrTruncatedRom, prgSize)
+	}
+	cartridge.chr, err = readNextNBytes(rom, cartridge.getChrRomSize(), "CHR ROM")
+	if err != nil {
+		return Cartridge{}, err
+	}
+
+	//NES 2.0 can declare no PRG RAM at all, iNES always has at least 8K
+	cartridge.wram = make([]byte, cartridge.getPrgRamSize()+cartridge.getPrgNvramSize())
+
+	//Boards without CHR ROM carry CHR RAM instead
+	if len(cartridge.chr) == 0 {
+		chrRamSize := cartridge.getChrRamSize() + cartridge.getChrNvramSize()
+		if chrRamSize == 0 {
+			chrRamSize = 0x2000
+		}
+		cartridge.chr = make([]byte, chrRamSize)
+		cartridge.hasChrRam = true
+	}
+
+	return cartridge, nil
+}
+
+//Reads through a LimitReader so the buffer only grows as far as the rom really goes
+func readNextNBytes(rom io.Reader, size int, section string) ([]byte, error) {
+	if size < 0 || size > maxRomSectionSize {
+		return nil, fmt.Errorf("%w: %v declares %v bytes", ErrRomTooLarge, section, size)
+	}
+	block, err := ioutil.ReadAll(io.LimitReader(rom, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+	if len(block) < size {
+		return nil, fmt.Errorf("%w: %v has %v of %v bytes", ErrTruncatedRom, section, len(block), size)
+	}
+
+	return block, nil
+}
+
+//Smaller PRG RAM is mirrored across $6000-$7FFF, only the first 8K of larger is mapped
+func (cart *Cartridge) readWram(offset uint16, openBus byte) byte {
+	if len(cart.wram) == 0 {
+		return openBus
+	}
+	return cart.wram[int(offset)%len(cart.wram)]
+}
+
+func (cart *Cartridge) writeWram(offset uint16, value byte) {
+	if len(cart.wram) == 0 {
+		return
+	}
+	offset = uint16(int(offset) % len(cart.wram))
+	if cart.wram[offset] != value {
+		cart.wram[offset] = value
+		cart.isWramDirty = true
+	}
+}
+
+//Pattern table writes only stick on CHR RAM
+func (cart *Cartridge) writeChr(offset int, value byte) {
+	if cart.hasChrRam {
+		cart.chr[offset%len(cart.chr)] = value
+	}
+}
+
+//ROM is identified by hash, only the writable parts are state
+func (cart *Cartridge) saveState(s *stateWriter) {
+	s.write(cart.wram, cart.vram)
+	if cart.hasChrRam {
+		s.write(cart.chr)
+	}
+}
+
+//Loaded wram replaces what is in the .sav file on the next flush
+func (cart *Cartridge) loadState(s *stateReader) {
+	s.read(cart.wram, &cart.vram)
+	if cart.hasChrRam {
+		s.read(cart.chr)
+	}
+	cart.isWramDirty = cart.hasBattery()
+}
+
+func (cart *Cartridge) isNES2() bool {
+	return cart.header.Flag7&0x0C == 0x08
+}
+
+//Lower nibble from Flag6, upper nibble from Flag7, NES 2.0 adds a third from Flag8
+func (cart *Cartridge) getMapperId() uint16 {
+	h := cart.header
+	mapperId := uint16(h.Flag6 >> 4)
+
+	if cart.isNES2() {
+		return mapperId | uint16(h.Flag7&0xF0) | uint16(h.Flag8&0x0F)<<8
+	}
+
+	if cart.hasDumperGarbage() {
+		return mapperId
+	}
+	return mapperId | uint16(h.Flag7&0xF0)
+}
+
+//Old dumpers wrote junk like "DiskDude!" over bytes 7-15
+func (cart *Cartridge) hasDumperGarbage() bool {
+	h := cart.header
+	return h.Flag12 != 0 || h.Flag13 != 0 || h.Flag14 != 0 || h.Flag15 != 0
+}
+
+func (cart *Cartridge) getSubmapperId() byte {
+	if !cart.isNES2() {
+		return 0
+	}
+	return cart.header.Flag8 >> 4
+}
+
+func (cart *Cartridge) getPrgRomSize() int {
+	if !cart.isNES2() {
+		return 0x4000 * int(cart.header.PrgRomSize)
+	}
+	return nes2RomSize(cart.header.PrgRomSize, cart.header.Flag9&0x0F, 0x4000)
+}
+
+func (cart *Cartridge) getChrRomSize() int {
+	if !cart.isNES2() {
+		return 0x2000 * int(cart.header.ChrRomSize)
+	}
+	return nes2RomSize(cart.header.ChrRomSize, cart.header.Flag9>>4, 0x2000)
+}
+
+//MSB nibble $F switches the LSB byte to exponent-multiplier form EEEEEEMM
+func nes2RomSize(lsb byte, msb byte, unit int) int {
+	if msb == 0x0F {
+		exponent := uint(lsb >> 2)
+		multiplier := int(lsb&3)*2 + 1
+		//2^63 and friends overflow, readNextNBytes rejects -1
+		if exponent > 30 {
+			return -1
+		}
+		return (1 << exponent) * multiplier
+	}
+	return (int(msb)<<8 | int(lsb)) * unit
+}
+
+//Sizes are shift counts, 64 << n bytes with 0 meaning none
+func nes2RamSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
+
+func (cart *Cartridge) getPrgRamSize() int {
+	if !cart.isNES2() {
+		//0 infers 8K for compatibility
+		if cart.header.Flag8 == 0 || cart.hasDumperGarbage() {
+			return 0x2000
+		}
+		return 0x2000 * int(cart.header.Flag8)
+	}
+	return nes2RamSize(cart.header.Flag10 & 0x0F)
+}
+
+func (cart *Cartridge) getPrgNvramSize() int {
+	if !cart.isNES2() {
+		return 0
+	}
+	return nes2RamSize(cart.header.Flag10 >> 4)
+}
+
+func (cart *Cartridge) getChrRamSize() int {
+	if !cart.isNES2() {
+		return 0
+	}
+	return nes2RamSize(cart.header.Flag11 & 0x0F)
+}
+
+func (cart *Cartridge) getChrNvramSize() int {
+	if !cart.isNES2() {
+		return 0
+	}
+	return nes2RamSize(cart.header.Flag11 >> 4)
+}
+
+func (cart *Cartridge) getTimingMode() byte {
+	if !cart.isNES2() {
+		return cart.header.Flag9 & 0x01
+	}
+	return cart.header.Flag12 & 0x03
+}
+
+func (cart *Cartridge) getConsoleType() byte {
+	return cart.header.Flag7 & 0x03
+}
+
+//Only meaningful for Vs. System carts
+func (cart *Cartridge) getVsPPUType() byte {
+	return cart.header.Flag13 & 0x0F
+}
+
+func (cart *Cartridge) getVsHardwareType() byte {
+	return cart.header.Flag13 >> 4
+}
+
+func (cart *Cartridge) hasBattery() bool {
+	return cart.header.Flag6&0x02 != 0
+}
+
+func (cart *Cartridge) getMirroringId() byte {
+	return cart.header.Flag6 & 0x01
+}
+
+//Mirroring hardwired on the board, four-screen overrides the solder pad
+func (cart *Cartridge) getNametableMirroring() byte {
+	if cart.header.Flag6&0x08 != 0 {
+		return mirrorFourScreen
+	}
+	return cart.getMirroringId()
+}
@@ -0,0 +1,225 @@
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func makeTestRom(header [16]byte, prgSize int, chrSize int) *bytes.Reader {
+	rom := append(header[:], make([]byte, prgSize+chrSize)...)
+	return bytes.NewReader(rom)
+}
+
+func TestReadRomINES(t *testing.T) {
+	header := [16]byte{'N', 'E', 'S', 0x1A, 2, 1, 0x21, 0x40}
+	cart, err := ReadRom(makeTestRom(header, 2*0x4000, 0x2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cart.isNES2() {
+		t.Errorf("iNES header detected as NES 2.0")
+	}
+	if got := cart.getMapperId(); got != 66 {
+		t.Errorf("expected mapper 66, got %v", got)
+	}
+	if got := cart.getPrgRamSize(); got != 0x2000 {
+		t.Errorf("expected 8K PRG RAM, got %v", got)
+	}
+	if len(cart.prg) != 0x8000 || len(cart.chr) != 0x2000 || cart.hasChrRam {
+		t.Errorf("unexpected PRG/CHR sizes %v/%v", len(cart.prg), len(cart.chr))
+	}
+}
+
+func TestReadRomIgnoresDiskDudeGarbage(t *testing.T) {
+	header := [16]byte{'N', 'E', 'S', 0x1A, 1, 1, 0x10, 'D', 'i', 's', 'k', 'D', 'u', 'd', 'e', '!'}
+	cart, err := ReadRom(makeTestRom(header, 0x4000, 0x2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cart.getMapperId(); got != 1 {
+		t.Errorf("expected mapper 1, got %v", got)
+	}
+	if len(cart.wram) != 0x2000 {
+		t.Errorf("expected the inferred 8K of wram, got %v", len(cart.wram))
+	}
+}
+
+func TestReadRomNES2(t *testing.T) {
+	header := [16]byte{'N', 'E', 'S', 0x1A,
+		0x02, 0x00, //2x16K PRG, CHR RAM
+		0x40, 0x09, //mapper 0x?4, NES 2.0, Vs. System
+		0x31,       //submapper 3, mapper MSB 1
+		0x00,
+		0x97,       //8K PRG RAM, 32K PRG NVRAM
+		0x07,       //8K CHR RAM
+		0x01,       //PAL
+		0x23,
+		0, 0}
+	cart, err := ReadRom(makeTestRom(header, 2*0x4000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cart.isNES2() {
+		t.Fatalf("NES 2.0 header not detected")
+	}
+	if got := cart.getMapperId(); got != 0x104 {
+		t.Errorf("expected mapper $104, got $%X", got)
+	}
+	if got := cart.getSubmapperId(); got != 3 {
+		t.Errorf("expected submapper 3, got %v", got)
+	}
+	if got := cart.getPrgRamSize(); got != 0x2000 {
+		t.Errorf("expected 8K PRG RAM, got %v", got)
+	}
+	if got := cart.getPrgNvramSize(); got != 0x8000 {
+		t.Errorf("expected 32K PRG NVRAM, got %v", got)
+	}
+	if len(cart.wram) != 0x2000+0x8000 {
+		t.Errorf("expected 40K of wram, got %v", len(cart.wram))
+	}
+	if got := cart.getTimingMode(); got != timingPAL {
+		t.Errorf("expected PAL timing, got %v", got)
+	}
+	if got := cart.getConsoleType(); got != consoleVsSystem {
+		t.Errorf("expected Vs. System, got %v", got)
+	}
+	if cart.getVsPPUType() != 3 || cart.getVsHardwareType() != 2 {
+		t.Errorf("unexpected Vs. types %v/%v", cart.getVsPPUType(), cart.getVsHardwareType())
+	}
+	if !cart.hasChrRam || len(cart.chr) != 0x2000 {
+		t.Errorf("expected 8K CHR RAM, got %v", len(cart.chr))
+	}
+}
+
+func TestNES2RomSize(t *testing.T) {
+	tests := []struct {
+		lsb, msb byte
+		unit     int
+		expected int
+	}{
+		{0x02, 0x0, 0x4000, 0x8000},
+		{0x00, 0x1, 0x4000, 0x400000},
+		{0x3C, 0xF, 0x4000, 1 << 15},     //2^15 * 1
+		{0x3D, 0xF, 0x4000, 3 * 1 << 15}, //2^15 * 3
+	}
+	for _, test := range tests {
+		if got := nes2RomSize(test.lsb, test.msb, test.unit); got != test.expected {
+			t.Errorf("lsb $%X msb $%X: expected %v, got %v", test.lsb, test.msb, test.expected, got)
+		}
+	}
+}
+
+func TestReadRomNES2ExponentSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		prg, chr byte //header bytes 4 and 5
+		msb      byte //header byte 9
+		romSize  int
+		prgSize  int
+		chrSize  int
+		err      error
+	}{
+		{"exponent PRG", 0x3C, 0x01, 0x0F, 0x8000 + 0x2000, 0x8000, 0x2000, nil},     //2^15 * 1
+		{"exponent CHR", 0x02, 0x35, 0xF0, 0x8000 + 3*0x2000, 0x8000, 3 * 0x2000, nil}, //2^13 * 3
+		{"2^63 PRG", 0xFC, 0x01, 0x0F, 0x8000, 0, 0, ErrRomTooLarge},
+		{"128M PRG", 0x6C, 0x01, 0x0F, 0x8000, 0, 0, ErrRomTooLarge}, //2^27 * 1
+	}
+	for _, test := range tests {
+		header := [16]byte{'N', 'E', 'S', 0x1A, test.prg, test.chr, 0x00, 0x08, 0x00, test.msb}
+		cart, err := ReadRom(makeTestRom(header, test.romSize, 0))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err == nil && (len(cart.prg) != test.prgSize || len(cart.chr) != test.chrSize) {
+			t.Errorf("%v: expected PRG/CHR %v/%v, got %v/%v", test.name, test.prgSize, test.chrSize, len(cart.prg), len(cart.chr))
+		}
+	}
+}
+
+func TestPrgRamSizedFromHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		flag7  byte
+		flag8  byte //iNES PRG RAM size in 8K units
+		flag10 byte //NES 2.0 PRG RAM/NVRAM shifts
+		size   int
+		want   byte //at $7800 after writing $5A to $6000 and $A5 to $67FF
+	}{
+		{"iNES inferred 8K", 0x00, 0x00, 0x00, 0x2000, 0x00},
+		{"iNES 16K", 0x00, 0x02, 0x00, 0x4000, 0x00},
+		{"NES 2.0 2K mirrored", 0x08, 0x00, 0x05, 0x800, 0x5A},
+		{"NES 2.0 2K NVRAM mirrored", 0x08, 0x00, 0x50, 0x800, 0x5A},
+		{"NES 2.0 none reads open bus", 0x08, 0x00, 0x00, 0, 0xA5},
+	}
+	for _, test := range tests {
+		header := [16]byte{'N', 'E', 'S', 0x1A, 2, 1, 0x00, test.flag7, test.flag8, 0x00, test.flag10}
+		nes, err := New(makeTestRom(header, 2*0x4000, 0x2000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nes.cart.wram) != test.size {
+			t.Errorf("%v: expected %v bytes of wram, got %v", test.name, test.size, len(nes.cart.wram))
+		}
+
+		nes.Write(0x6000, 0x5A)
+		nes.Write(0x67FF, 0xA5)
+		if got := nes.Read(0x7800); got != test.want {
+			t.Errorf("%v: expected $%02X at $7800, got $%02X", test.name, test.want, got)
+		}
+	}
+}
+
+func TestNewRejectsShortPrgRom(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag6   byte
+		flag7   byte
+		prg     byte //header byte 4
+		msb     byte //header byte 9
+		romSize int
+		err     error
+	}{
+		{"mapper 0 without PRG", 0x00, 0x00, 0, 0x00, 0, ErrTruncatedRom},
+		{"mapper 1 without PRG", 0x10, 0x00, 0, 0x00, 0, ErrTruncatedRom},
+		{"mapper 2 without PRG", 0x20, 0x00, 0, 0x00, 0, ErrTruncatedRom},
+		{"mapper 2 8K exponent PRG", 0x20, 0x08, 0x34, 0x0F, 0x2000, ErrTruncatedRom}, //2^13 * 1
+		{"mapper 4 8K exponent PRG", 0x40, 0x08, 0x34, 0x0F, 0x2000, ErrTruncatedRom},
+		{"mapper 0 8K exponent PRG", 0x00, 0x08, 0x34, 0x0F, 0x2000, nil},
+		{"mapper 2 24K exponent PRG", 0x20, 0x08, 0x35, 0x0F, 3 * 0x2000, nil}, //2^13 * 3
+	}
+	for _, test := range tests {
+		header := [16]byte{'N', 'E', 'S', 0x1A, test.prg, 0, test.flag6, test.flag7, 0x00, test.msb}
+		if _, err := New(makeTestRom(header, test.romSize, 0)); !errors.Is(err, test.err) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestReadRomErrors(t *testing.T) {
+	if _, err := ReadRom(bytes.NewReader([]byte("NES"))); !errors.Is(err, ErrTruncatedRom) {
+		t.Errorf("short header: expected ErrTruncatedRom, got %v", err)
+	}
+
+	bad := [16]byte{'U', 'N', 'I', 'F'}
+	if _, err := ReadRom(makeTestRom(bad, 0x4000, 0x2000)); err != ErrBadMagic {
+		t.Errorf("expected ErrBadMagic, got %v", err)
+	}
+
+	header := [16]byte{'N', 'E', 'S', 0x1A, 2, 1}
+	if _, err := ReadRom(makeTestRom(header, 0x4000, 0)); !errors.Is(err, ErrTruncatedRom) {
+		t.Errorf("short PRG: expected ErrTruncatedRom, got %v", err)
+	}
+	if _, err := ReadRom(makeTestRom(header, 2*0x4000, 0x1000)); !errors.Is(err, ErrTruncatedRom) {
+		t.Errorf("short CHR: expected ErrTruncatedRom, got %v", err)
+	}
+
+	unsupported := [16]byte{'N', 'E', 'S', 0x1A, 2, 1, 0x50} //mapper 5
+	if _, err := New(makeTestRom(unsupported, 2*0x4000, 0x2000)); !errors.Is(err, ErrUnsupportedMapper) {
+		t.Errorf("expected ErrUnsupportedMapper, got %v", err)
+	}
+}
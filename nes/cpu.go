@@ -1,10 +1,11 @@
-package main
+package nes
 import (
 
 )
 
 type Cpu struct {
 	memory Memory
+	nes *NES //caught up before register accesses
 	PC     uint16
 	A      byte
 	X      byte
@@ -15,10 +16,24 @@ type Cpu struct {
 	cycles uint64
 	suspendCycles uint64
 
-	nmiRequested bool
-	irqRequested bool
+	nmiRequested bool //edge-triggered, latched until the CPU takes it
+	irqLine byte //level-triggered, one bit per source
+	irqInhibited bool //I as the last instruction polled it, CLI, SEI and PLP take effect one instruction late
+	interruptPending bool //polled on the second to last cycle of the last instruction
+	readModifyWrite bool //the current instruction reads its operand 2 cycles before writing it back
+	writeCycle uint64 //of the last write, the MMC1 ignores the second of two on consecutive cycles
+
+	halted bool //by a STP opcode, only reset gets the CPU going again
+	haltOpcode byte
 }
 
+//Sources that can hold the IRQ line low
+const (
+	irqSourceMapper = 1<<0
+	irqSourceDMC = 1<<1
+	irqSourceFrameCounter = 1<<2
+)
+
 const (
 	_   = iota
 	imp = "implicit"
@@ -55,290 +70,290 @@ var opcodes = [256]struct {
 }{
 	{"BRK", imp, 7, 0, 1}, //0x0
 	{"ORA", inx, 6, 0, 2}, // x1
-	{},                    //{STP, imp, 0, 0, 0}, // x2
-	{},                    //{SLO, inx, 8, 0, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"SLO", inx, 8, 0, 2}, // x3
 	{"NOP", zep, 3, 0, 2}, // x4
 	{"ORA", zep, 3, 0, 2}, // x5
 	{"ASL", zep, 5, 0, 2}, // x6
-	{},                    //{SLO, zep, 5, 0, 0}, // x7
+	{"SLO", zep, 5, 0, 2}, // x7
 	{"PHP", imp, 3, 0, 1}, // x8
 	{"ORA", imm, 2, 0, 2}, // x9
 	{"ASL", acc, 2, 0, 1}, // xA
-	{},                    //{ANC, imm, 2, 0}, // xB
+	{"ANC", imm, 2, 0, 2}, // xB
 	{"NOP", abs, 4, 0, 3}, // xC
 	{"ORA", abs, 4, 0, 3}, // xD
 	{"ASL", abs, 6, 0, 3}, // xE
-	{},                    //{SLO, abs, 6, 0}, // xF
+	{"SLO", abs, 6, 0, 3}, // xF
 
 	// 1x
 	{"BPL", rel, 2, 1, 2}, // x0
 	{"ORA", iny, 5, 1, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{SLO, iny, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"SLO", iny, 8, 0, 2}, // x3
 	{"NOP", zpx, 4, 0, 2}, // x4
 	{"ORA", zpx, 4, 0, 2}, // x5
 	{"ASL", zpx, 6, 0, 2}, // x6
-	{},                    //{SLO, zpx, 6, 0}, // x7
+	{"SLO", zpx, 6, 0, 2}, // x7
 	{"CLC", imp, 2, 0, 1}, // x8
 	{"ORA", aby, 4, 1, 3}, // x9
 	{"NOP", imp, 2, 0, 1}, // xA
-	{},                    //{SLO, aby, 7, 0}, // xB
+	{"SLO", aby, 7, 0, 3}, // xB
 	{"NOP", abx, 4, 1, 3}, // xC
 	{"ORA", abx, 4, 1, 3}, // xD
 	{"ASL", abx, 7, 0, 3}, // xE
-	{},                    //{SLO, abx, 7, 0}, // xF
+	{"SLO", abx, 7, 0, 3}, // xF
 
 	// 2x
 	{"JSR", abs, 6, 0, 3}, // x0
 	{"AND", inx, 6, 0, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{RLA, inx, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"RLA", inx, 8, 0, 2}, // x3
 	{"BIT", zep, 3, 0, 2}, // x4
 	{"AND", zep, 3, 0, 2}, // x5
 	{"ROL", zep, 5, 0, 2}, // x6
-	{},                    //{RLA, zep, 5, 0}, // x7
+	{"RLA", zep, 5, 0, 2}, // x7
 	{"PLP", imp, 4, 0, 1}, // x8
 	{"AND", imm, 2, 0, 2}, // x9
 	{"ROL", acc, 2, 0, 1}, // xA
-	{},                    //{ANC, imm, 2, 0}, // xB
+	{"ANC", imm, 2, 0, 2}, // xB
 	{"BIT", abs, 4, 0, 3}, // xC
 	{"AND", abs, 4, 0, 3}, // xD
 	{"ROL", abs, 6, 0, 3}, // xE
-	{},                    //{RLA, abs, 6, 0}, // xF
+	{"RLA", abs, 6, 0, 3}, // xF
 
 	// 3x
 	{"BMI", rel, 2, 1, 2}, // x0
 	{"AND", iny, 5, 1, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{RLA, iny, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"RLA", iny, 8, 0, 2}, // x3
 	{"NOP", zpx, 4, 0, 2}, // x4
 	{"AND", zpx, 4, 0, 2}, // x5
 	{"ROL", zpx, 6, 0, 2}, // x6
-	{},                    //{RLA, zpx, 6, 0}, // x7
+	{"RLA", zpx, 6, 0, 2}, // x7
 	{"SEC", imp, 2, 0, 1}, // x8
 	{"AND", aby, 4, 1, 3}, // x9
 	{"NOP", imp, 2, 0, 1}, // xA
-	{},                    //{RLA, aby, 7, 0}, // xB
+	{"RLA", aby, 7, 0, 3}, // xB
 	{"NOP", abx, 4, 1, 3}, // xC
 	{"AND", abx, 4, 1, 3}, // xD
 	{"ROL", abx, 7, 0, 3}, // xE
-	{},                    //{RLA, abx, 7, 0}, // xF
+	{"RLA", abx, 7, 0, 3}, // xF
 
 	// 4x
 	{"RTI", imp, 6, 0, 1}, // x0
 	{"EOR", inx, 6, 0, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{SRE, inx, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"SRE", inx, 8, 0, 2}, // x3
 	{"NOP", zep, 3, 0, 2}, // x4
 	{"EOR", zep, 3, 0, 2}, // x5
 	{"LSR", zep, 5, 0, 2}, // x6
-	{},                    //{SRE, zep, 5, 0}, // x7
+	{"SRE", zep, 5, 0, 2}, // x7
 	{"PHA", imp, 3, 0, 1}, // x8
 	{"EOR", imm, 2, 0, 2}, // x9
-	{"LSR", imp, 2, 0, 1}, // xA
-	{},                    //{ALR, imm, 2, 0}, // xB
+	{"LSR", acc, 2, 0, 1}, // xA
+	{"ALR", imm, 2, 0, 2}, // xB
 	{"JMP", abs, 3, 0, 3}, // xC
 	{"EOR", abs, 4, 0, 3}, // xD
 	{"LSR", abs, 6, 0, 3}, // xE
-	{},                    //{SRE, abs, 6, 0}, // xF
+	{"SRE", abs, 6, 0, 3}, // xF
 
 	// 5x
 	{"BVC", rel, 2, 1, 2}, // x0
 	{"EOR", iny, 5, 1, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{SRE, iny, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"SRE", iny, 8, 0, 2}, // x3
 	{"NOP", zpx, 4, 0, 2}, // x4
 	{"EOR", zpx, 4, 0, 2}, // x5
 	{"LSR", zpx, 6, 0, 2}, // x6
-	{},                    //{SRE, zpx, 6, 0}, // x7
+	{"SRE", zpx, 6, 0, 2}, // x7
 	{"CLI", imp, 2, 0, 1}, // x8
 	{"EOR", aby, 4, 1, 3}, // x9
 	{"NOP", imp, 2, 0, 1}, // xA
-	{},                    //{SRE, aby, 7, 0}, // xB
+	{"SRE", aby, 7, 0, 3}, // xB
 	{"NOP", abx, 4, 1, 3}, // xC
 	{"EOR", abx, 4, 1, 3}, // xD
 	{"LSR", abx, 7, 0, 3}, // xE
-	{},                    //{SRE, abx, 7, 0}, // xF
+	{"SRE", abx, 7, 0, 3}, // xF
 
 	// 6x
 	{"RTS", imp, 6, 0, 1}, // x0
 	{"ADC", inx, 6, 0, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{RRA, inx, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"RRA", inx, 8, 0, 2}, // x3
 	{"NOP", zep, 3, 0, 2}, // x4
 	{"ADC", zep, 3, 0, 2}, // x5
 	{"ROR", zep, 5, 0, 2}, // x6
-	{},                    //{RRA, zep, 5, 0}, // x7
+	{"RRA", zep, 5, 0, 2}, // x7
 	{"PLA", imp, 4, 0, 1}, // x8
 	{"ADC", imm, 2, 0, 2}, // x9
-	{"ROR", imp, 2, 0, 1}, // xA
-	{},                    //{ARR, imm, 2, 0}, // xB
+	{"ROR", acc, 2, 0, 1}, // xA
+	{"ARR", imm, 2, 0, 2}, // xB
 	{"JMP", ind, 5, 0, 3}, // xC
 	{"ADC", abs, 4, 0, 3}, // xD
 	{"ROR", abs, 6, 0, 3}, // xE
-	{},                    //{RRA, abs, 6, 0}, // xF
+	{"RRA", abs, 6, 0, 3}, // xF
 
 	// 7x
 	{"BVS", rel, 2, 1, 2}, // x0
 	{"ADC", iny, 5, 1, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{RRA, iny, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"RRA", iny, 8, 0, 2}, // x3
 	{"NOP", zpx, 4, 0, 2}, // x4
 	{"ADC", zpx, 4, 0, 2}, // x5
 	{"ROR", zpx, 6, 0, 2}, // x6
-	{},                    //{RRA, zpx, 6, 0}, // x7
+	{"RRA", zpx, 6, 0, 2}, // x7
 	{"SEI", imp, 2, 0, 1}, // x8
 	{"ADC", aby, 4, 1, 3}, // x9
 	{"NOP", imp, 2, 0, 1}, // xA
-	{},                    //{RRA, aby, 7, 0}, // xB
+	{"RRA", aby, 7, 0, 3}, // xB
 	{"NOP", abx, 4, 1, 3}, // xC
 	{"ADC", abx, 4, 1, 3}, // xD
 	{"ROR", abx, 7, 0, 3}, // xE
-	{},                    //{RRA, abx, 7, 0}, // xF
+	{"RRA", abx, 7, 0, 3}, // xF
 
 	// 8x
 	{"NOP", imm, 2, 0, 2}, // x0
 	{"STA", inx, 6, 0, 2}, // x1
 	{"NOP", imm, 2, 0, 2}, // x2
-	{},                    //{SAX, inx, 6, 0}, // x3
+	{"SAX", inx, 6, 0, 2}, // x3
 	{"STY", zep, 3, 0, 2}, // x4
 	{"STA", zep, 3, 0, 2}, // x5
 	{"STX", zep, 3, 0, 2}, // x6
-	{},                    //{SAX, zep, 3, 0}, // x7
+	{"SAX", zep, 3, 0, 2}, // x7
 	{"DEY", imp, 2, 0, 1}, // x8
 	{"NOP", imm, 2, 0, 2}, // x9
 	{"TXA", imp, 2, 0, 1}, // xA
-	{},                    //{XAA, imm, 2, 1}, // xB
+	{"XAA", imm, 2, 0, 2}, // xB
 	{"STY", abs, 4, 0, 3}, // xC
 	{"STA", abs, 4, 0, 3}, // xD
 	{"STX", abs, 4, 0, 3}, // xE
-	{},                    //{SAX, abs, 4, 0}, // xF
+	{"SAX", abs, 4, 0, 3}, // xF
 
 	// 9x
 	{"BCC", rel, 2, 1, 2}, // x0
 	{"STA", iny, 6, 0, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{AHX, iny, 6, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"SHA", iny, 6, 0, 2}, // x3
 	{"STY", zpx, 4, 0, 2}, // x4
 	{"STA", zpx, 4, 0, 2}, // x5
 	{"STX", zpy, 4, 0, 2}, // x6
-	{},                    //{SAX, zpy, 4, 0}, // x7
+	{"SAX", zpy, 4, 0, 2}, // x7
 	{"TYA", imp, 2, 0, 1}, // x8
 	{"STA", aby, 5, 0, 3}, // x9
 	{"TXS", imp, 2, 0, 1}, // xA
-	{},                    //{TAS, aby, 5, 0}, // xB
-	{},                    //{SHY, abx, 5, 0}, // xC
+	{"TAS", aby, 5, 0, 3}, // xB
+	{"SHY", abx, 5, 0, 3}, // xC
 	{"STA", abx, 5, 0, 3}, // xD
-	{},                    //{SHX, aby, 5, 0}, // xE
-	{},                    //{AHX, aby, 5, 0}, // xF
+	{"SHX", aby, 5, 0, 3}, // xE
+	{"SHA", aby, 5, 0, 3}, // xF
 
 	// Ax
 	{"LDY", imm, 2, 0, 2}, // x0
 	{"LDA", inx, 6, 0, 2}, // x1
 	{"LDX", imm, 2, 0, 2}, // x2
-	{},                    //{LAX, inx, 6, 0}, // x3
+	{"LAX", inx, 6, 0, 2}, // x3
 	{"LDY", zep, 3, 0, 2}, // x4
 	{"LDA", zep, 3, 0, 2}, // x5
 	{"LDX", zep, 3, 0, 2}, // x6
-	{},                    //{LAX, zep, 3, 0}, // x7
+	{"LAX", zep, 3, 0, 2}, // x7
 	{"TAY", imp, 2, 0, 1}, // x8
 	{"LDA", imm, 2, 0, 2}, // x9
 	{"TAX", imp, 2, 0, 1}, // xA
-	{},                    //{LAX, imm, 2, 0}, // xB
+	{"LAX", imm, 2, 0, 2}, // xB
 	{"LDY", abs, 4, 0, 3}, // xC
 	{"LDA", abs, 4, 0, 3}, // xD
 	{"LDX", abs, 4, 0, 3}, // xE
-	{},                    //{LAX, abs, 4, 0}, // xF
+	{"LAX", abs, 4, 0, 3}, // xF
 
 	// Bx
 	{"BCS", rel, 2, 1, 2}, // x0
 	{"LDA", iny, 5, 1, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{LAX, iny, 5, 1}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"LAX", iny, 5, 1, 2}, // x3
 	{"LDY", zpx, 4, 0, 2}, // x4
 	{"LDA", zpx, 4, 0, 2}, // x5
 	{"LDX", zpy, 4, 0, 2}, // x6
-	{},                    //{LAX, zpy, 4, 0}, // x7
+	{"LAX", zpy, 4, 0, 2}, // x7
 	{"CLV", imp, 2, 0, 1}, // x8
 	{"LDA", aby, 4, 1, 3}, // x9
 	{"TSX", imp, 2, 0, 1}, // xA
-	{},                    //{LAS, aby, 4, 1}, // xB
+	{"LAS", aby, 4, 1, 3}, // xB
 	{"LDY", abx, 4, 1, 3}, // xC
 	{"LDA", abx, 4, 1, 3}, // xD
 	{"LDX", aby, 4, 1, 3}, // xE
-	{},                    //{LAX, aby, 4, 1}, // xF
+	{"LAX", aby, 4, 1, 3}, // xF
 
 	// Cx
 	{"CPY", imm, 2, 0, 2}, // x0
 	{"CMP", inx, 6, 0, 2}, // x1
 	{"NOP", imm, 2, 0, 2}, // x2
-	{},                    //{DCP, inx, 8, 0}, // x3
+	{"DCP", inx, 8, 0, 2}, // x3
 	{"CPY", zep, 3, 0, 2}, // x4
 	{"CMP", zep, 3, 0, 2}, // x5
 	{"DEC", zep, 5, 0, 2}, // x6
-	{},                    //{DCP, zep, 5, 0}, // x7
+	{"DCP", zep, 5, 0, 2}, // x7
 	{"INY", imp, 2, 0, 1}, // x8
 	{"CMP", imm, 2, 0, 2}, // x9
 	{"DEX", imp, 2, 0, 1}, // xA
-	{},                    //{AXS, imm, 2, 0}, // xB
+	{"AXS", imm, 2, 0, 2}, // xB
 	{"CPY", abs, 4, 0, 3}, // xC
 	{"CMP", abs, 4, 0, 3}, // xD
 	{"DEC", abs, 6, 0, 3}, // xE
-	{},                    //{DCP, abs, 6, 0}, // xF
+	{"DCP", abs, 6, 0, 3}, // xF
 
 	// Dx
 	{"BNE", rel, 2, 1, 2}, // x0
 	{"CMP", iny, 5, 1, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{DCP, iny, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"DCP", iny, 8, 0, 2}, // x3
 	{"NOP", zpx, 4, 0, 2}, // x4
 	{"CMP", zpx, 4, 0, 2}, // x5
 	{"DEC", zpx, 6, 0, 2}, // x6
-	{},                    //{DCP, zpx, 6, 0}, // x7
+	{"DCP", zpx, 6, 0, 2}, // x7
 	{"CLD", imp, 2, 0, 1}, // x8
 	{"CMP", aby, 4, 1, 3}, // x9
 	{"NOP", imp, 2, 0, 1}, // xA
-	{},                    //{DCP, aby, 7, 0}, // xB
+	{"DCP", aby, 7, 0, 3}, // xB
 	{"NOP", abx, 4, 1, 3}, // xC
 	{"CMP", abx, 4, 1, 3}, // xD
 	{"DEC", abx, 7, 0, 3}, // xE
-	{},                    //{DCP, abx, 7, 0}, // xF
+	{"DCP", abx, 7, 0, 3}, // xF
 
 	// Ex
 	{"CPX", imm, 2, 0, 2}, // x0
 	{"SBC", inx, 6, 0, 2}, // x1
 	{"NOP", imm, 2, 0, 2}, // x2
-	{},                    //{ISC, inx, 8, 0}, // x3
+	{"ISC", inx, 8, 0, 2}, // x3
 	{"CPX", zep, 3, 0, 2}, // x4
 	{"SBC", zep, 3, 0, 2}, // x5
 	{"INC", zep, 5, 0, 2}, // x6
-	{},                    //{ISC, zep, 5, 0}, // x7
+	{"ISC", zep, 5, 0, 2}, // x7
 	{"INX", imp, 2, 0, 1}, // x8
 	{"SBC", imm, 2, 0, 2}, // x9
 	{"NOP", imp, 2, 0, 1}, // xA
-	{"SBC", imm, 2, 0, 0}, // xB
+	{"SBC", imm, 2, 0, 2}, // xB
 	{"CPX", abs, 4, 0, 3}, // xC
 	{"SBC", abs, 4, 0, 3}, // xD
 	{"INC", abs, 6, 0, 3}, // xE
-	{},                    //{ISC, abs, 6, 0}, // xF
+	{"ISC", abs, 6, 0, 3}, // xF
 
 	// Fx
 	{"BEQ", rel, 2, 1, 2}, // x0
 	{"SBC", iny, 5, 1, 2}, // x1
-	{},                    //{STP, imp, 0, 0}, // x2
-	{},                    //{ISC, iny, 8, 0}, // x3
+	{"STP", imp, 2, 0, 0}, // x2
+	{"ISC", iny, 8, 0, 2}, // x3
 	{"NOP", zpx, 4, 0, 2}, // x4
 	{"SBC", zpx, 4, 0, 2}, // x5
 	{"INC", zpx, 6, 0, 2}, // x6
-	{},                    //{ISC, zpx, 6, 0}, // x7
+	{"ISC", zpx, 6, 0, 2}, // x7
 	{"SED", imp, 2, 0, 1}, // x8
 	{"SBC", aby, 4, 1, 3}, // x9
 	{"NOP", imp, 2, 0, 1}, // xA
-	{},                    //{ISC, aby, 7, 0}, // xB
+	{"ISC", aby, 7, 0, 3}, // xB
 	{"NOP", abx, 4, 1, 3}, // xC
 	{"SBC", abx, 4, 1, 3}, // xD
 	{"INC", abx, 7, 0, 3}, // xE
-	{},                    //{ISC, abx, 7, 0}} // xF
+	{"ISC", abx, 7, 0, 3}, // xF
 }
 
 //Addressing modes
@@ -348,7 +363,7 @@ func (cpu *Cpu) immediateAddress() uint16 {
 }
 
 func (cpu *Cpu) zeroPageAddress() uint16 {
-	address := cpu.memory.Read(cpu.PC + 1)
+	address := cpu.read(cpu.PC + 1)
 	return uint16(address)
 }
 
@@ -358,7 +373,7 @@ func (cpu *Cpu) absoluteAddress() uint16 {
 }
 
 func (cpu *Cpu) relativeAddress() uint16 {
-	offset := uint16(cpu.memory.Read(cpu.PC + 1))
+	offset := uint16(cpu.read(cpu.PC + 1))
 
 	var address uint16
 	//offset is byte from 0x0 to 0xff
@@ -386,19 +401,19 @@ func (cpu *Cpu) ReadBuggyUint16(addr uint16) uint16 {
 	lowAddress := addr
 	highAddress := (addr & 0xFF00) | uint16(byte(addr)+1)
 
-	indirectLowAddress := cpu.memory.Read(lowAddress)
-	indirectHighAddress := cpu.memory.Read(highAddress)
+	indirectLowAddress := cpu.read(lowAddress)
+	indirectHighAddress := cpu.read(highAddress)
 
 	return (uint16(indirectHighAddress) << 8) + uint16(indirectLowAddress)
 }
 
 func (cpu *Cpu) zeroPageXAddress() uint16 {
-	address := cpu.memory.Read(cpu.PC + 1)
+	address := cpu.read(cpu.PC + 1)
 	return uint16(address + cpu.X)
 }
 
 func (cpu *Cpu) zeroPageYAddress() uint16 {
-	address := cpu.memory.Read(cpu.PC + 1)
+	address := cpu.read(cpu.PC + 1)
 	return uint16(address + cpu.Y)
 }
 
@@ -413,21 +428,24 @@ func (cpu *Cpu) absoluteYAddress() uint16 {
 }
 
 func (cpu *Cpu) indexIndirectAddress() uint16 {
-	tmpAddress := cpu.memory.Read(cpu.PC+1) + cpu.X
+	tmpAddress := cpu.read(cpu.PC+1) + cpu.X
 	address := cpu.ReadBuggyUint16(uint16(tmpAddress))
 	return address
 }
 
 func (cpu *Cpu) indirectIndexedAddress() uint16 {
-	tmpAddress := cpu.memory.Read(cpu.PC + 1)
+	tmpAddress := cpu.read(cpu.PC + 1)
 	address := cpu.ReadBuggyUint16(uint16(tmpAddress)) + uint16(cpu.Y)
 	return address
 }
 
 //instructions
 func (cpu *Cpu) adc(address uint16) {
+	cpu.adcValue(cpu.read(address))
+}
+
+func (cpu *Cpu) adcValue(b byte) {
 	a := cpu.A
-	b := cpu.memory.Read(address)
 	c := cpu.getSetFlag(CFlag)
 
 	cpu.A = a + b + c
@@ -459,7 +477,11 @@ func (cpu *Cpu) adc(address uint16) {
 }
 
 func (cpu *Cpu) and(address uint16) {
-	cpu.A &= cpu.memory.Read(address)
+	cpu.andValue(cpu.read(address))
+}
+
+func (cpu *Cpu) andValue(m byte) {
+	cpu.A &= m
 	if cpu.A == 0 {
 		cpu.setFlag(ZFlag)
 	} else {
@@ -496,10 +518,15 @@ func (cpu *Cpu) aslAcc() {
 	}
 }
 
-func (cpu *Cpu) asl(address uint16) {
-	carry := cpu.memory.Read(address) & NFlag
-	res := cpu.memory.Read(address) << 1
-	cpu.memory.Write(address, res)
+//Read-modify-write instructions read their operand once, a second read
+//would repeat register side effects, write it back unmodified and then
+//write the result on the next cycle, which they return
+func (cpu *Cpu) asl(address uint16) byte {
+	m := cpu.read(address)
+	cpu.dummyWrite(address, m)
+	carry := m & NFlag
+	res := m << 1
+	cpu.write(address, res)
 	
 	if carry > 0 {
 		cpu.setFlag(CFlag)
@@ -518,6 +545,7 @@ func (cpu *Cpu) asl(address uint16) {
 	} else {
 		cpu.clearFlag(NFlag)
 	}
+	return res
 }
 
 
@@ -549,7 +577,7 @@ func (cpu *Cpu) beq(address uint16) {
 
 func (cpu *Cpu) bit(address uint16) {
 	a := cpu.A
-	m := cpu.memory.Read(address)
+	m := cpu.read(address)
 
 	if a&m == 0 {
 		cpu.setFlag(ZFlag)
@@ -591,9 +619,9 @@ func (cpu *Cpu) bpl(address uint16) {
 	}
 }
 
+//The byte after BRK is skipped, the handler returns to PC+2
 func (cpu *Cpu) brk() {
-	cpu.irqRequested = true
-	cpu.setFlag(BFlag)
+	cpu.interrupt(cpu.PC+1, BFlag)
 }
 
 func (cpu *Cpu) bvc(address uint16) {
@@ -627,8 +655,11 @@ func (cpu *Cpu) clv() {
 }
 
 func (cpu *Cpu) cmp(address uint16) {
+	cpu.cmpValue(cpu.read(address))
+}
+
+func (cpu *Cpu) cmpValue(m byte) {
 	a := cpu.A
-	m := cpu.memory.Read(address)
 
 	if a >= m {
 		cpu.setFlag(CFlag)
@@ -651,7 +682,7 @@ func (cpu *Cpu) cmp(address uint16) {
 
 func (cpu *Cpu) cpx(address uint16) {
 	x := cpu.X
-	m := cpu.memory.Read(address)
+	m := cpu.read(address)
 
 	if x >= m {
 		cpu.setFlag(CFlag)
@@ -674,7 +705,7 @@ func (cpu *Cpu) cpx(address uint16) {
 
 func (cpu *Cpu) cpy(address uint16) {
 	y := cpu.Y
-	m := cpu.memory.Read(address)
+	m := cpu.read(address)
 
 	if y >= m {
 		cpu.setFlag(CFlag)
@@ -695,10 +726,11 @@ func (cpu *Cpu) cpy(address uint16) {
 	}
 }
 
-func (cpu *Cpu) dec(address uint16) {
-	m := cpu.memory.Read(address)
+func (cpu *Cpu) dec(address uint16) byte {
+	m := cpu.read(address)
+	cpu.dummyWrite(address, m)
 	res := m - 1
-	cpu.memory.Write(address, res)
+	cpu.write(address, res)
 
 	if res == 0 {
 		cpu.setFlag(ZFlag)
@@ -711,6 +743,7 @@ func (cpu *Cpu) dec(address uint16) {
 	} else {
 		cpu.clearFlag(NFlag)
 	}
+	return res
 }
 
 func (cpu *Cpu) dex() {
@@ -746,7 +779,11 @@ func (cpu *Cpu) dey() {
 }
 
 func (cpu *Cpu) eor(address uint16) {
-	cpu.A = cpu.A ^ cpu.memory.Read(address)
+	cpu.eorValue(cpu.read(address))
+}
+
+func (cpu *Cpu) eorValue(m byte) {
+	cpu.A = cpu.A ^ m
 
 	if cpu.A == 0 {
 		cpu.setFlag(ZFlag)
@@ -761,10 +798,11 @@ func (cpu *Cpu) eor(address uint16) {
 	}
 }
 
-func (cpu *Cpu) inc(address uint16) {
-	m := cpu.memory.Read(address)
+func (cpu *Cpu) inc(address uint16) byte {
+	m := cpu.read(address)
+	cpu.dummyWrite(address, m)
 	res := m + 1
-	cpu.memory.Write(address, res)
+	cpu.write(address, res)
 
 	if res == 0 {
 		cpu.setFlag(ZFlag)
@@ -777,6 +815,7 @@ func (cpu *Cpu) inc(address uint16) {
 	} else {
 		cpu.clearFlag(NFlag)
 	}
+	return res
 }
 
 func (cpu *Cpu) inx() {
@@ -821,7 +860,7 @@ func (cpu *Cpu) jsr(address uint16) {
 }
 
 func (cpu *Cpu) lda(address uint16) {
-	cpu.A = cpu.memory.Read(address)
+	cpu.A = cpu.read(address)
 
 	if cpu.A == 0 {
 		cpu.setFlag(ZFlag)
@@ -837,7 +876,7 @@ func (cpu *Cpu) lda(address uint16) {
 }
 
 func (cpu *Cpu) ldx(address uint16) {
-	cpu.X = cpu.memory.Read(address)
+	cpu.X = cpu.read(address)
 	if cpu.X == 0 {
 		cpu.setFlag(ZFlag)
 	} else {
@@ -854,7 +893,7 @@ func (cpu *Cpu) ldx(address uint16) {
 }
 
 func (cpu *Cpu) ldy(address uint16) {
-	cpu.Y = cpu.memory.Read(address)
+	cpu.Y = cpu.read(address)
 
 	if cpu.Y == 0 {
 		cpu.setFlag(ZFlag)
@@ -869,12 +908,13 @@ func (cpu *Cpu) ldy(address uint16) {
 	}
 }
 
-func (cpu *Cpu) lsr(address uint16) {
+func (cpu *Cpu) lsr(address uint16) byte {
 	//todo?
-	m := cpu.memory.Read(address)
+	m := cpu.read(address)
+	cpu.dummyWrite(address, m)
 	oldBit0 := m & 0x01
 	m >>= 1
-	cpu.memory.Write(address, m)
+	cpu.write(address, m)
 
 	if oldBit0 > 0 {
 		cpu.setFlag(CFlag)
@@ -893,6 +933,7 @@ func (cpu *Cpu) lsr(address uint16) {
 	} else {
 		cpu.clearFlag(NFlag)
 	}
+	return m
 }
 
 func (cpu *Cpu) lsrAcc() {
@@ -923,8 +964,19 @@ func (cpu *Cpu) nop() {
 	
 }
 
+//Also known as KIL or JAM, the CPU locks up with PC on the opcode until reset
+//https://wiki.nesdev.com/w/index.php/CPU_unofficial_opcodes
+func (cpu *Cpu) stp(opcode byte) {
+	cpu.halted = true
+	cpu.haltOpcode = opcode
+}
+
 func (cpu *Cpu) ora(address uint16) {
-	cpu.A |= cpu.memory.Read(address)
+	cpu.oraValue(cpu.read(address))
+}
+
+func (cpu *Cpu) oraValue(m byte) {
+	cpu.A |= m
 
 	if cpu.A == 0 {
 		cpu.setFlag(ZFlag)
@@ -966,8 +1018,9 @@ func (cpu *Cpu) plp() {
 	cpu.P = (cpu.pull() & 0xEF) | 0x20
 }
 
-func (cpu *Cpu) rol(address uint16) {
-	m := cpu.memory.Read(address)
+func (cpu *Cpu) rol(address uint16) byte {
+	m := cpu.read(address)
+	cpu.dummyWrite(address, m)
 	
 	currentCarry := cpu.getSetFlag(CFlag)
 	if m & NFlag == NFlag {
@@ -977,7 +1030,7 @@ func (cpu *Cpu) rol(address uint16) {
 	}
 	value := (m << 1) | currentCarry
 
-	cpu.memory.Write(address, value)
+	cpu.write(address, value)
 
 
 	if value == 0 {
@@ -991,6 +1044,7 @@ func (cpu *Cpu) rol(address uint16) {
 	} else {
 		cpu.clearFlag(NFlag)
 	}
+	return value
 }
 
 func (cpu *Cpu) rolAcc() {
@@ -1018,8 +1072,9 @@ func (cpu *Cpu) rolAcc() {
 	}
 }
 
-func (cpu *Cpu) ror(address uint16) {
-	m := cpu.memory.Read(address)
+func (cpu *Cpu) ror(address uint16) byte {
+	m := cpu.read(address)
+	cpu.dummyWrite(address, m)
 	
 	currentCarry := cpu.getSetFlag(CFlag)
 	if m & CFlag == CFlag {
@@ -1029,16 +1084,10 @@ func (cpu *Cpu) ror(address uint16) {
 	}
 	value := (m >> 1) | (currentCarry << 7)
 
-	cpu.memory.Write(address, value)
+	cpu.write(address, value)
 
 	
-	if value > 0 {
-		cpu.setFlag(CFlag)
-	} else {
-		cpu.clearFlag(CFlag)
-	}
-
-	if cpu.A == 0 {
+	if value == 0 {
 		cpu.setFlag(ZFlag)
 	} else {
 		cpu.clearFlag(ZFlag)
@@ -1049,7 +1098,7 @@ func (cpu *Cpu) ror(address uint16) {
 	} else {
 		cpu.clearFlag(NFlag)
 	}
-
+	return value
 }
 
 func (cpu *Cpu) rorAcc() {
@@ -1087,8 +1136,11 @@ func (cpu *Cpu) rts() {
 }
 
 func (cpu *Cpu) sbc(address uint16) {
+	cpu.sbcValue(cpu.read(address))
+}
+
+func (cpu *Cpu) sbcValue(m byte) {
 	a := cpu.A
-	m := cpu.memory.Read(address)
 	c := cpu.getSetFlag(CFlag)
 
 	cpu.A = a - m - (1 - c)
@@ -1133,15 +1185,15 @@ func (cpu *Cpu) sei() {
 }
 
 func (cpu *Cpu) sta(address uint16) {
-	cpu.memory.Write(address, cpu.A)
+	cpu.write(address, cpu.A)
 }
 
 func (cpu *Cpu) stx(address uint16) {
-	cpu.memory.Write(address, cpu.X)
+	cpu.write(address, cpu.X)
 }
 
 func (cpu *Cpu) sty(address uint16) {
-	cpu.memory.Write(address, cpu.Y)
+	cpu.write(address, cpu.Y)
 }
 
 func (cpu *Cpu) tax() {
@@ -1228,50 +1280,256 @@ func (cpu *Cpu) tya() {
 	}
 }
 
+//Unofficial instructions
+//https://wiki.nesdev.com/w/index.php/Programming_with_unofficial_opcodes
+//http://www.oxyron.de/html/opcodes02.html
+
+//Read-modify-write followed by an ALU operation on the value written, without reading it again
+func (cpu *Cpu) slo(address uint16) {
+	cpu.oraValue(cpu.asl(address))
+}
+
+func (cpu *Cpu) rla(address uint16) {
+	cpu.andValue(cpu.rol(address))
+}
+
+func (cpu *Cpu) sre(address uint16) {
+	cpu.eorValue(cpu.lsr(address))
+}
+
+func (cpu *Cpu) rra(address uint16) {
+	cpu.adcValue(cpu.ror(address))
+}
+
+func (cpu *Cpu) dcp(address uint16) {
+	cpu.cmpValue(cpu.dec(address))
+}
+
+func (cpu *Cpu) isc(address uint16) {
+	cpu.sbcValue(cpu.inc(address))
+}
+
+func (cpu *Cpu) sax(address uint16) {
+	cpu.write(address, cpu.A&cpu.X)
+}
+
+func (cpu *Cpu) lax(address uint16) {
+	cpu.lda(address)
+	cpu.X = cpu.A
+}
+
+//AND then copy N to C
+func (cpu *Cpu) anc(address uint16) {
+	cpu.and(address)
+	if cpu.isFlagSet(NFlag) {
+		cpu.setFlag(CFlag)
+	} else {
+		cpu.clearFlag(CFlag)
+	}
+}
+
+func (cpu *Cpu) alr(address uint16) {
+	cpu.and(address)
+	cpu.lsrAcc()
+}
+
+//AND then ROR A, with C from bit 6 and V from bit 6 xor bit 5
+func (cpu *Cpu) arr(address uint16) {
+	cpu.and(address)
+	cpu.rorAcc()
+
+	if cpu.A&0x40 != 0 {
+		cpu.setFlag(CFlag)
+	} else {
+		cpu.clearFlag(CFlag)
+	}
+
+	if (cpu.A>>6^cpu.A>>5)&1 != 0 {
+		cpu.setFlag(VFlag)
+	} else {
+		cpu.clearFlag(VFlag)
+	}
+}
+
+//X = A&X minus the operand without borrow, flags like CMP
+func (cpu *Cpu) axs(address uint16) {
+	ax := cpu.A & cpu.X
+	m := cpu.read(address)
+	cpu.X = ax - m
+
+	if ax >= m {
+		cpu.setFlag(CFlag)
+	} else {
+		cpu.clearFlag(CFlag)
+	}
+
+	if cpu.X == 0 {
+		cpu.setFlag(ZFlag)
+	} else {
+		cpu.clearFlag(ZFlag)
+	}
+
+	if cpu.X&NFlag == NFlag {
+		cpu.setFlag(NFlag)
+	} else {
+		cpu.clearFlag(NFlag)
+	}
+}
+
+func (cpu *Cpu) las(address uint16) {
+	cpu.SP &= cpu.read(address)
+	cpu.X = cpu.SP
+	cpu.A = cpu.SP
+
+	if cpu.A == 0 {
+		cpu.setFlag(ZFlag)
+	} else {
+		cpu.clearFlag(ZFlag)
+	}
+
+	if cpu.A&NFlag == NFlag {
+		cpu.setFlag(NFlag)
+	} else {
+		cpu.clearFlag(NFlag)
+	}
+}
+
+//Unstable instructions, the 2A03 mixes in a chip dependent constant.
+//$EE is what most consoles show for XAA and immediate LAX.
+const unstableMagic = 0xEE
+
+func (cpu *Cpu) xaa(address uint16) {
+	cpu.A = (cpu.A | unstableMagic) & cpu.X
+	cpu.and(address)
+}
+
+//Immediate LAX goes through the same bus conflict as XAA
+func (cpu *Cpu) laxImmediate(address uint16) {
+	cpu.A |= unstableMagic
+	cpu.and(address)
+	cpu.X = cpu.A
+}
+
+//SHA, SHX, SHY and TAS store value AND the high byte of the base address
+//plus one. When indexing crosses a page the stored value replaces the
+//high byte of the address as well.
+func (cpu *Cpu) storeAndHigh(address uint16, index byte, value byte) {
+	base := address - uint16(index)
+	value &= byte(base>>8) + 1
+	if isPageCrossed(base, address) {
+		address = uint16(value)<<8 | address&0xFF
+	}
+	cpu.write(address, value)
+}
+
+func (cpu *Cpu) sha(address uint16, index byte) {
+	cpu.storeAndHigh(address, index, cpu.A&cpu.X)
+}
+
+func (cpu *Cpu) shx(address uint16, index byte) {
+	cpu.storeAndHigh(address, index, cpu.X)
+}
+
+func (cpu *Cpu) shy(address uint16, index byte) {
+	cpu.storeAndHigh(address, index, cpu.Y)
+}
+
+func (cpu *Cpu) tas(address uint16, index byte) {
+	cpu.SP = cpu.A & cpu.X
+	cpu.storeAndHigh(address, index, cpu.SP)
+}
+
 func MakeNewCpu(nes *NES) *Cpu {
 	cpu := Cpu{
 		memory: nes,
+		nes: nes,
 		P: 0x24,
 		SP: 0xFD,
 		nmiRequested: false,
-		irqRequested: false,
+		irqInhibited: true,
 	}
 	cpu.PC = cpu.ReadUint16(0xFFFC)
 
 	return &cpu
 }
 
-func (cpu *Cpu) promptNMI() {
-	cpu.pushUint16(cpu.PC)
-	cpu.push(cpu.P)
-	cpu.PC = cpu.ReadUint16(0xFFFA)
+//Reset leaves A, X, Y and memory alone
+func (cpu *Cpu) reset() {
+	cpu.SP -= 3
 	cpu.setFlag(IFlag)
+	cpu.PC = cpu.ReadUint16(0xFFFC)
 	cpu.nmiRequested = false
+	cpu.irqInhibited = true
+	cpu.interruptPending = false
+	cpu.suspendCycles = 0
+	cpu.halted = false
+}
+
+//The 7 cycle sequence shared by BRK, IRQ and NMI. B is only set in the pushed copy
+//of P, by BRK. An NMI that comes in before the vector is fetched hijacks BRK and
+//IRQ, they run the NMI handler instead.
+//https://wiki.nesdev.com/w/index.php/CPU_interrupts
+func (cpu *Cpu) interrupt(returnAddress uint16, b byte) {
+	cpu.pushUint16(returnAddress)
+	cpu.push(cpu.P&^BFlag | 0x20 | b)
+	cpu.setFlag(IFlag)
+	//The vector is fetched on the last 2 cycles
+	cpu.nes.catchUp(cpu.cycles - 3)
+	vector := uint16(0xFFFE)
+	if cpu.nmiRequested {
+		vector = 0xFFFA
+		cpu.nmiRequested = false
+	}
+	cpu.PC = cpu.ReadUint16(vector)
 }
 
-func (cpu *Cpu) promptIRQ() {
-	cpu.pushUint16(cpu.PC)
-	cpu.push(cpu.P)
-	cpu.PC = cpu.ReadUint16(0xFFFE)
-	cpu.setFlag(IFlag)
-	cpu.irqRequested = false
+//The line stays asserted until the source acknowledges it
+func (cpu *Cpu) assertIRQ(source byte) {
+	cpu.irqLine |= source
 }
 
+func (cpu *Cpu) acknowledgeIRQ(source byte) {
+	cpu.irqLine &= source^0xFF
+}
+
+//Runs one instruction, interrupt or DMA stall and returns the CPU cycles it took,
+//page crossings and taken branches included. The PPU and APU are caught up before
+//register accesses and the interrupt poll, the caller catches them up to the end.
 func (cpu *Cpu) run() int{
 
-	if cpu.nmiRequested {
-		cpu.promptNMI()
+	//OAM and DMC DMA take the bus away from the CPU
+	if cpu.suspendCycles > 0 {
+		stall := cpu.suspendCycles
+		cpu.suspendCycles = 0
+		cpu.cycles += stall
+		cpu.pollInterrupts()
+		return int(stall)
 	}
-	
-	if cpu.irqRequested {
-		cpu.promptIRQ()
+
+	//A halted CPU ignores interrupts, the rest of the console keeps running
+	if cpu.halted {
+		cpu.cycles++
+		return 1
+	}
+
+	//Taking an interrupt is a step of its own, the handler's first instruction
+	//always runs before the next poll
+	if cpu.interruptPending {
+		cpu.interruptPending = false
+		cpu.cycles += 7
+		cpu.interrupt(cpu.PC, 0)
+		cpu.irqInhibited = true
+		return 7
 	}
 
-	opcode := cpu.memory.Read(cpu.PC)
+	startCycles := cpu.cycles
+	cpu.readModifyWrite = false
+	opcode := cpu.read(cpu.PC)
+	irqInhibited := cpu.isFlagSet(IFlag)
+	cpu.readModifyWrite = isReadModifyWrite(opcode)
 	
 	addressingMode := opcodes[opcode].addressingMode
 	pageHasCrossed := false
-	//currentCpuCycles := cpu.cycles
 
 	var address uint16
 	switch addressingMode {
@@ -1308,7 +1566,6 @@ func (cpu *Cpu) run() int{
 		cpu.cycles += uint64(opcodes[opcode].additionalCycles)
 	}
 
-	//updatedCpuCycles := cpu.cycles
 	switch opcode {
 
 	case 0x0:
@@ -1316,9 +1573,9 @@ func (cpu *Cpu) run() int{
 	case 0x1:
 		cpu.ora(address)
 	case 0x2:
-		break
+		cpu.stp(opcode)
 	case 0x3:
-		break
+		cpu.slo(address)
 	case 0x4:
 		cpu.nop()
 	case 0x5:
@@ -1326,7 +1583,7 @@ func (cpu *Cpu) run() int{
 	case 0x6:
 		cpu.asl(address)
 	case 0x7:
-		break
+		cpu.slo(address)
 	case 0x8:
 		cpu.php()
 	case 0x9:
@@ -1334,7 +1591,7 @@ func (cpu *Cpu) run() int{
 	case 0xa:
 		cpu.aslAcc()
 	case 0xb:
-		break
+		cpu.anc(address)
 	case 0xc:
 		cpu.nop()
 	case 0xd:
@@ -1342,15 +1599,15 @@ func (cpu *Cpu) run() int{
 	case 0xe:
 		cpu.asl(address)
 	case 0xf:
-		break
+		cpu.slo(address)
 	case 0x10:
 		cpu.bpl(address)
 	case 0x11:
 		cpu.ora(address)
 	case 0x12:
-		break
+		cpu.stp(opcode)
 	case 0x13:
-		break
+		cpu.slo(address)
 	case 0x14:
 		cpu.nop()
 	case 0x15:
@@ -1358,7 +1615,7 @@ func (cpu *Cpu) run() int{
 	case 0x16:
 		cpu.asl(address)
 	case 0x17:
-		break
+		cpu.slo(address)
 	case 0x18:
 		cpu.clc()
 	case 0x19:
@@ -1366,7 +1623,7 @@ func (cpu *Cpu) run() int{
 	case 0x1a:
 		cpu.nop()
 	case 0x1b:
-		break
+		cpu.slo(address)
 	case 0x1c:
 		cpu.nop()
 	case 0x1d:
@@ -1374,15 +1631,15 @@ func (cpu *Cpu) run() int{
 	case 0x1e:
 		cpu.asl(address)
 	case 0x1f:
-		break
+		cpu.slo(address)
 	case 0x20:
 		cpu.jsr(address)
 	case 0x21:
 		cpu.and(address)
 	case 0x22:
-		break
+		cpu.stp(opcode)
 	case 0x23:
-		break
+		cpu.rla(address)
 	case 0x24:
 		cpu.bit(address)
 	case 0x25:
@@ -1390,7 +1647,7 @@ func (cpu *Cpu) run() int{
 	case 0x26:
 		cpu.rol(address)
 	case 0x27:
-		break
+		cpu.rla(address)
 	case 0x28:
 		cpu.plp()
 	case 0x29:
@@ -1398,7 +1655,7 @@ func (cpu *Cpu) run() int{
 	case 0x2a:
 		cpu.rolAcc()
 	case 0x2b:
-		break
+		cpu.anc(address)
 	case 0x2c:
 		cpu.bit(address)
 	case 0x2d:
@@ -1406,15 +1663,15 @@ func (cpu *Cpu) run() int{
 	case 0x2e:
 		cpu.rol(address)
 	case 0x2f:
-		break
+		cpu.rla(address)
 	case 0x30:
 		cpu.bmi(address)
 	case 0x31:
 		cpu.and(address)
 	case 0x32:
-		break
+		cpu.stp(opcode)
 	case 0x33:
-		break
+		cpu.rla(address)
 	case 0x34:
 		cpu.nop()
 	case 0x35:
@@ -1422,7 +1679,7 @@ func (cpu *Cpu) run() int{
 	case 0x36:
 		cpu.rol(address)
 	case 0x37:
-		break
+		cpu.rla(address)
 	case 0x38:
 		cpu.sec()
 	case 0x39:
@@ -1430,7 +1687,7 @@ func (cpu *Cpu) run() int{
 	case 0x3a:
 		cpu.nop()
 	case 0x3b:
-		break
+		cpu.rla(address)
 	case 0x3c:
 		cpu.nop()
 	case 0x3d:
@@ -1438,15 +1695,15 @@ func (cpu *Cpu) run() int{
 	case 0x3e:
 		cpu.rol(address)
 	case 0x3f:
-		break
+		cpu.rla(address)
 	case 0x40:
 		cpu.rti()
 	case 0x41:
 		cpu.eor(address)
 	case 0x42:
-		break
+		cpu.stp(opcode)
 	case 0x43:
-		break
+		cpu.sre(address)
 	case 0x44:
 		cpu.nop()
 	case 0x45:
@@ -1454,7 +1711,7 @@ func (cpu *Cpu) run() int{
 	case 0x46:
 		cpu.lsr(address)
 	case 0x47:
-		break
+		cpu.sre(address)
 	case 0x48:
 		cpu.pha()
 	case 0x49:
@@ -1462,7 +1719,7 @@ func (cpu *Cpu) run() int{
 	case 0x4a:
 		cpu.lsrAcc()
 	case 0x4b:
-		break
+		cpu.alr(address)
 	case 0x4c:
 		cpu.jmp(address)
 	case 0x4d:
@@ -1470,15 +1727,15 @@ func (cpu *Cpu) run() int{
 	case 0x4e:
 		cpu.lsr(address)
 	case 0x4f:
-		break
+		cpu.sre(address)
 	case 0x50:
 		cpu.bvc(address)
 	case 0x51:
 		cpu.eor(address)
 	case 0x52:
-		break
+		cpu.stp(opcode)
 	case 0x53:
-		break
+		cpu.sre(address)
 	case 0x54:
 		cpu.nop()
 	case 0x55:
@@ -1486,7 +1743,7 @@ func (cpu *Cpu) run() int{
 	case 0x56:
 		cpu.lsr(address)
 	case 0x57:
-		break
+		cpu.sre(address)
 	case 0x58:
 		cpu.cli()
 	case 0x59:
@@ -1494,7 +1751,7 @@ func (cpu *Cpu) run() int{
 	case 0x5a:
 		cpu.nop()
 	case 0x5b:
-		break
+		cpu.sre(address)
 	case 0x5c:
 		cpu.nop()
 	case 0x5d:
@@ -1502,15 +1759,15 @@ func (cpu *Cpu) run() int{
 	case 0x5e:
 		cpu.lsr(address)
 	case 0x5f:
-		break
+		cpu.sre(address)
 	case 0x60:
 		cpu.rts()
 	case 0x61:
 		cpu.adc(address)
 	case 0x62:
-		break
+		cpu.stp(opcode)
 	case 0x63:
-		break
+		cpu.rra(address)
 	case 0x64:
 		cpu.nop()
 	case 0x65:
@@ -1518,7 +1775,7 @@ func (cpu *Cpu) run() int{
 	case 0x66:
 		cpu.ror(address)
 	case 0x67:
-		break
+		cpu.rra(address)
 	case 0x68:
 		cpu.pla()
 	case 0x69:
@@ -1526,7 +1783,7 @@ func (cpu *Cpu) run() int{
 	case 0x6a:
 		cpu.rorAcc()
 	case 0x6b:
-		break
+		cpu.arr(address)
 	case 0x6c:
 		cpu.jmp(address)
 	case 0x6d:
@@ -1534,15 +1791,15 @@ func (cpu *Cpu) run() int{
 	case 0x6e:
 		cpu.ror(address)
 	case 0x6f:
-		break
+		cpu.rra(address)
 	case 0x70:
 		cpu.bvs(address)
 	case 0x71:
 		cpu.adc(address)
 	case 0x72:
-		break
+		cpu.stp(opcode)
 	case 0x73:
-		break
+		cpu.rra(address)
 	case 0x74:
 		cpu.nop()
 	case 0x75:
@@ -1550,7 +1807,7 @@ func (cpu *Cpu) run() int{
 	case 0x76:
 		cpu.ror(address)
 	case 0x77:
-		break
+		cpu.rra(address)
 	case 0x78:
 		cpu.sei()
 	case 0x79:
@@ -1558,7 +1815,7 @@ func (cpu *Cpu) run() int{
 	case 0x7a:
 		cpu.nop()
 	case 0x7b:
-		break
+		cpu.rra(address)
 	case 0x7c:
 		cpu.nop()
 	case 0x7d:
@@ -1566,7 +1823,7 @@ func (cpu *Cpu) run() int{
 	case 0x7e:
 		cpu.ror(address)
 	case 0x7f:
-		break
+		cpu.rra(address)
 	case 0x80:
 		cpu.nop()
 	case 0x81:
@@ -1574,7 +1831,7 @@ func (cpu *Cpu) run() int{
 	case 0x82:
 		cpu.nop()
 	case 0x83:
-		break
+		cpu.sax(address)
 	case 0x84:
 		cpu.sty(address)
 	case 0x85:
@@ -1582,7 +1839,7 @@ func (cpu *Cpu) run() int{
 	case 0x86:
 		cpu.stx(address)
 	case 0x87:
-		break
+		cpu.sax(address)
 	case 0x88:
 		cpu.dey()
 	case 0x89:
@@ -1590,7 +1847,7 @@ func (cpu *Cpu) run() int{
 	case 0x8a:
 		cpu.txa()
 	case 0x8b:
-		break
+		cpu.xaa(address)
 	case 0x8c:
 		cpu.sty(address)
 	case 0x8d:
@@ -1598,15 +1855,15 @@ func (cpu *Cpu) run() int{
 	case 0x8e:
 		cpu.stx(address)
 	case 0x8f:
-		break
+		cpu.sax(address)
 	case 0x90:
 		cpu.bcc(address)
 	case 0x91:
 		cpu.sta(address)
 	case 0x92:
-		break
+		cpu.stp(opcode)
 	case 0x93:
-		break
+		cpu.sha(address, cpu.Y)
 	case 0x94:
 		cpu.sty(address)
 	case 0x95:
@@ -1614,7 +1871,7 @@ func (cpu *Cpu) run() int{
 	case 0x96:
 		cpu.stx(address)
 	case 0x97:
-		break
+		cpu.sax(address)
 	case 0x98:
 		cpu.tya()
 	case 0x99:
@@ -1622,15 +1879,15 @@ func (cpu *Cpu) run() int{
 	case 0x9a:
 		cpu.txs()
 	case 0x9b:
-		break
+		cpu.tas(address, cpu.Y)
 	case 0x9c:
-		break
+		cpu.shy(address, cpu.X)
 	case 0x9d:
 		cpu.sta(address)
 	case 0x9e:
-		break
+		cpu.shx(address, cpu.Y)
 	case 0x9f:
-		break
+		cpu.sha(address, cpu.Y)
 	case 0xa0:
 		cpu.ldy(address)
 	case 0xa1:
@@ -1638,7 +1895,7 @@ func (cpu *Cpu) run() int{
 	case 0xa2:
 		cpu.ldx(address)
 	case 0xa3:
-		break
+		cpu.lax(address)
 	case 0xa4:
 		cpu.ldy(address)
 	case 0xa5:
@@ -1646,7 +1903,7 @@ func (cpu *Cpu) run() int{
 	case 0xa6:
 		cpu.ldx(address)
 	case 0xa7:
-		break
+		cpu.lax(address)
 	case 0xa8:
 		cpu.tay()
 	case 0xa9:
@@ -1654,7 +1911,7 @@ func (cpu *Cpu) run() int{
 	case 0xaa:
 		cpu.tax()
 	case 0xab:
-		break
+		cpu.laxImmediate(address)
 	case 0xac:
 		cpu.ldy(address)
 	case 0xad:
@@ -1662,15 +1919,15 @@ func (cpu *Cpu) run() int{
 	case 0xae:
 		cpu.ldx(address)
 	case 0xaf:
-		break
+		cpu.lax(address)
 	case 0xb0:
 		cpu.bcs(address)
 	case 0xb1:
 		cpu.lda(address)
 	case 0xb2:
-		break
+		cpu.stp(opcode)
 	case 0xb3:
-		break
+		cpu.lax(address)
 	case 0xb4:
 		cpu.ldy(address)
 	case 0xb5:
@@ -1678,7 +1935,7 @@ func (cpu *Cpu) run() int{
 	case 0xb6:
 		cpu.ldx(address)
 	case 0xb7:
-		break
+		cpu.lax(address)
 	case 0xb8:
 		cpu.clv()
 	case 0xb9:
@@ -1686,7 +1943,7 @@ func (cpu *Cpu) run() int{
 	case 0xba:
 		cpu.tsx()
 	case 0xbb:
-		break
+		cpu.las(address)
 	case 0xbc:
 		cpu.ldy(address)
 	case 0xbd:
@@ -1694,7 +1951,7 @@ func (cpu *Cpu) run() int{
 	case 0xbe:
 		cpu.ldx(address)
 	case 0xbf:
-		break
+		cpu.lax(address)
 	case 0xc0:
 		cpu.cpy(address)
 	case 0xc1:
@@ -1702,7 +1959,7 @@ func (cpu *Cpu) run() int{
 	case 0xc2:
 		cpu.nop()
 	case 0xc3:
-		break
+		cpu.dcp(address)
 	case 0xc4:
 		cpu.cpy(address)
 	case 0xc5:
@@ -1710,7 +1967,7 @@ func (cpu *Cpu) run() int{
 	case 0xc6:
 		cpu.dec(address)
 	case 0xc7:
-		break
+		cpu.dcp(address)
 	case 0xc8:
 		cpu.iny()
 	case 0xc9:
@@ -1718,7 +1975,7 @@ func (cpu *Cpu) run() int{
 	case 0xca:
 		cpu.dex()
 	case 0xcb:
-		break
+		cpu.axs(address)
 	case 0xcc:
 		cpu.cpy(address)
 	case 0xcd:
@@ -1726,15 +1983,15 @@ func (cpu *Cpu) run() int{
 	case 0xce:
 		cpu.dec(address)
 	case 0xcf:
-		break
+		cpu.dcp(address)
 	case 0xd0:
 		cpu.bne(address)
 	case 0xd1:
 		cpu.cmp(address)
 	case 0xd2:
-		break
+		cpu.stp(opcode)
 	case 0xd3:
-		break
+		cpu.dcp(address)
 	case 0xd4:
 		cpu.nop()
 	case 0xd5:
@@ -1742,7 +1999,7 @@ func (cpu *Cpu) run() int{
 	case 0xd6:
 		cpu.dec(address)
 	case 0xd7:
-		break
+		cpu.dcp(address)
 	case 0xd8:
 		cpu.cld()
 	case 0xd9:
@@ -1750,7 +2007,7 @@ func (cpu *Cpu) run() int{
 	case 0xda:
 		cpu.nop()
 	case 0xdb:
-		break
+		cpu.dcp(address)
 	case 0xdc:
 		cpu.nop()
 	case 0xdd:
@@ -1758,7 +2015,7 @@ func (cpu *Cpu) run() int{
 	case 0xde:
 		cpu.dec(address)
 	case 0xdf:
-		break
+		cpu.dcp(address)
 	case 0xe0:
 		cpu.cpx(address)
 	case 0xe1:
@@ -1766,7 +2023,7 @@ func (cpu *Cpu) run() int{
 	case 0xe2:
 		cpu.nop()
 	case 0xe3:
-		break
+		cpu.isc(address)
 	case 0xe4:
 		cpu.cpx(address)
 	case 0xe5:
@@ -1774,7 +2031,7 @@ func (cpu *Cpu) run() int{
 	case 0xe6:
 		cpu.inc(address)
 	case 0xe7:
-		break
+		cpu.isc(address)
 	case 0xe8:
 		cpu.inx()
 	case 0xe9:
@@ -1790,15 +2047,15 @@ func (cpu *Cpu) run() int{
 	case 0xee:
 		cpu.inc(address)
 	case 0xef:
-		break
+		cpu.isc(address)
 	case 0xf0:
 		cpu.beq(address)
 	case 0xf1:
 		cpu.sbc(address)
 	case 0xf2:
-		break
+		cpu.stp(opcode)
 	case 0xf3:
-		break
+		cpu.isc(address)
 	case 0xf4:
 		cpu.nop()
 	case 0xf5:
@@ -1806,7 +2063,7 @@ func (cpu *Cpu) run() int{
 	case 0xf6:
 		cpu.inc(address)
 	case 0xf7:
-		break
+		cpu.isc(address)
 	case 0xf8:
 		cpu.sed()
 	case 0xf9:
@@ -1814,7 +2071,7 @@ func (cpu *Cpu) run() int{
 	case 0xfa:
 		cpu.nop()
 	case 0xfb:
-		break
+		cpu.isc(address)
 	case 0xfc:
 		cpu.nop()
 	case 0xfd:
@@ -1822,10 +2079,37 @@ func (cpu *Cpu) run() int{
 	case 0xfe:
 		cpu.inc(address)
 	case 0xff:
-		break
+		cpu.isc(address)
 	}
 
-	return int(opcodes[opcode].cycles)
+	//CLI, SEI and PLP change I after the poll
+	switch opcode {
+	case 0x28, 0x58, 0x78:
+		cpu.irqInhibited = irqInhibited
+	default:
+		cpu.irqInhibited = cpu.isFlagSet(IFlag)
+	}
+	cpu.pollInterrupts()
+
+	return int(cpu.cycles - startCycles)
+}
+
+//https://wiki.nesdev.com/w/index.php/CPU_interrupts#Detailed_interrupt_behavior
+func (cpu *Cpu) pollInterrupts() {
+	cpu.nes.catchUp(cpu.cycles - 1)
+	cpu.interruptPending = cpu.nmiRequested || cpu.irqLine != 0 && !cpu.irqInhibited
+}
+
+func isReadModifyWrite(opcode byte) bool {
+	switch opcodes[opcode].addressingMode {
+	case imp, acc, imm, rel:
+		return false
+	}
+	switch opcodes[opcode].name {
+	case "ASL", "LSR", "ROL", "ROR", "INC", "DEC", "SLO", "RLA", "SRE", "RRA", "DCP", "ISC":
+		return true
+	}
+	return false
 }
 
 func computeCyclesForBranch(pc uint16, addr uint16) uint64{
@@ -1863,8 +2147,39 @@ func (cpu *Cpu) getSetFlag(flag byte) byte {
 	return 0
 }
 
+//Reads and writes of registers land on the last cycle of an instruction, a
+//read-modify-write reads 2 cycles earlier and writes on both of the last 2 cycles,
+//RAM and PRG reads can't tell
+//https://wiki.nesdev.com/w/index.php/6502_cycle_times
+func (cpu *Cpu) read(addr uint16) byte {
+	if addr >= 0x2000 && addr < 0x4020 {
+		cycle := cpu.cycles - 1
+		if cpu.readModifyWrite {
+			cycle -= 2
+		}
+		cpu.nes.catchUp(cycle)
+	}
+	return cpu.memory.Read(addr)
+}
+
+func (cpu *Cpu) write(addr uint16, value byte) {
+	cpu.writeOnCycle(addr, value, cpu.cycles - 1)
+}
+
+func (cpu *Cpu) dummyWrite(addr uint16, value byte) {
+	cpu.writeOnCycle(addr, value, cpu.cycles - 2)
+}
+
+func (cpu *Cpu) writeOnCycle(addr uint16, value byte, cycle uint64) {
+	if addr >= 0x2000 {
+		cpu.nes.catchUp(cycle)
+	}
+	cpu.writeCycle = cycle
+	cpu.memory.Write(addr, value)
+}
+
 func (cpu *Cpu) push(value byte) {
-	cpu.memory.Write(uint16(cpu.SP)|0x100, value)
+	cpu.write(uint16(cpu.SP)|0x100, value)
 	cpu.SP--
 }
 
@@ -1875,7 +2190,7 @@ func (cpu *Cpu) pushUint16(value uint16) {
 
 func (cpu *Cpu) pull() byte {
 	cpu.SP++
-	r := cpu.memory.Read(uint16(cpu.SP) | 0x100)
+	r := cpu.read(uint16(cpu.SP) | 0x100)
 	return r
 }
 
@@ -1884,3 +2199,13 @@ func (cpu *Cpu) pullUint16() uint16 {
 	high := uint16(cpu.pull())
 	return high<<8 | low
 }
+
+func (cpu *Cpu) saveState(s *stateWriter) {
+	s.write(cpu.PC, cpu.A, cpu.X, cpu.Y, cpu.SP, cpu.P, cpu.cycles, cpu.suspendCycles,
+		cpu.nmiRequested, cpu.irqLine, cpu.irqInhibited, cpu.interruptPending, cpu.halted, cpu.haltOpcode)
+}
+
+func (cpu *Cpu) loadState(s *stateReader) {
+	s.read(&cpu.PC, &cpu.A, &cpu.X, &cpu.Y, &cpu.SP, &cpu.P, &cpu.cycles, &cpu.suspendCycles,
+		&cpu.nmiRequested, &cpu.irqLine, &cpu.irqInhibited, &cpu.interruptPending, &cpu.halted, &cpu.haltOpcode)
+}
@@ -0,0 +1,486 @@
+package nes
+
+import(
+	"errors"
+	"testing"
+	"os"
+	"bufio"
+	"strings"
+	"regexp"
+	"fmt"
+)
+
+func TestCpuOpcodes(t *testing.T) {
+	romPath := "../roms/test/nestest.nes"
+	cart, err := LoadRom(romPath)
+	if err != nil {
+		t.Skipf("nestest rom not available: %v", err)
+	}
+	nes := &NES{}
+	nes.cart = &cart
+	nes.mapper, _ = MakeNewMapper(nes)
+	nes.ppu = MakeNewPPU(nes)
+	nes.cpu = MakeNewCpu(nes)
+	nes.apu = MakeNewAPU(nes)
+
+	//nestest.nes starts at $C000
+	nes.cpu.PC = 0xC000
+	nes.cpu.cycles = 7
+
+	expectedLogPath := "../roms/test/nestest.log"
+	file, err := os.Open(expectedLogPath)
+	if err != nil {
+		t.Skipf("nestest log not available: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineCount := 0 
+	for scanner.Scan() {
+		lineCount++
+
+		line := scanner.Text()
+		s := strings.Split(line, " ")
+		c := make([]string, 0)
+		for _, e := range s {
+			if e != "" {
+				c = append(c, e)
+			}
+		}
+
+		re := regexp.MustCompile(`(A:\w\d)|(A:\d\w)|(A:\w\w)|(A:\d\d)`)
+		var aIdx int
+		for i, _ := range c {
+			if re.MatchString(c[i]) {
+				aIdx = i
+			}
+		}
+		
+		expectedPC := c[0]
+		expectedA := c[aIdx]
+		expectedX := c[aIdx + 1]
+		expectedY := c[aIdx + 2]
+		expectedP := c[aIdx + 3]
+		expectedSP := c[aIdx + 4]
+		// expectedScanline := 0
+		// expectedPPUCycle := 0
+		expectedCycle := c[len(c)-1]
+
+		cpu := nes.cpu
+		actualPC := fmt.Sprintf("%04X", cpu.PC)
+		actualA := fmt.Sprintf("A:%02X", cpu.A)
+		actualX := fmt.Sprintf("X:%02X", cpu.X)
+		actualY := fmt.Sprintf("Y:%02X", cpu.Y)
+		actualP := fmt.Sprintf("P:%X", cpu.P)
+		actualSP := fmt.Sprintf("SP:%X", cpu.SP)
+		// actualScanline := fmt.Sprintf()
+		// actualPPUCycle := fmt.Sprintf()
+		actualCycle := fmt.Sprintf("CYC:%v", cpu.cycles)
+
+		printDiff := func(whichRegister string) {
+			
+			t.Errorf("%v @Line:%v \n Expected: %v %v %v %v %v %v %v\n      Got: %04v %v %v %v %v %v %v\n", whichRegister, lineCount, expectedPC, expectedA, expectedX,
+				expectedY, expectedP, expectedSP, expectedCycle , actualPC, actualA, actualX, actualY, actualP, actualSP, actualCycle)
+		}
+		
+		if expectedPC != actualPC {			
+			printDiff("PC")
+			break
+		}
+		if expectedA != actualA {
+			printDiff("A")
+			break
+		}
+		if expectedX != actualX {
+			printDiff("X")
+			break	
+		}
+		if expectedY != actualY {
+			printDiff("Y")
+			break
+		}
+		if expectedP != actualP {
+			printDiff("P")
+			break
+		}
+		if expectedSP != actualSP {
+			printDiff("SP")
+			break
+		}
+		if expectedCycle != actualCycle {
+			printDiff("CYC")
+			break
+		}
+		
+		nes.cpu.run()
+
+	}
+
+}
+
+// func TestCpuWrite(t *testing.T) {
+// 	romPath := "../roms/test/cpu_dummy_writes_ppumem.nes"
+// 	cart := LoadRom(romPath)
+// 	ram := make([]byte, 0xFFFF+1)
+// 	nes := NES{ram: ram}
+// 	nes.cart = &cart
+// 	nes.mapper = MakeNewMapper(&nes)
+// 	nes.ppu = MakeNewPPU(&nes)
+// 	nes.cpu = MakeNewCpu(&nes)
+
+// 	for i := 0; i < 100000; i++{
+// 	nes.cpu.run()
+// 	}
+// }
+
+func TestUnofficialOpcodes(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		program       []byte
+		a, x, p       byte
+		addr          uint16
+		memory        byte
+		wantA, wantX  byte
+		wantP         byte
+		wantMemory    byte
+		wantCycles    uint64
+	}{
+		{"SLO zp", []byte{0x07, 0x10}, 0x01, 0, 0x24, 0x10, 0xC0, 0x81, 0, 0xA5, 0x80, 5},
+		{"RLA zp", []byte{0x27, 0x10}, 0x7F, 0, 0x24, 0x10, 0x80, 0x00, 0, 0x27, 0x00, 5},
+		{"SRE zp", []byte{0x47, 0x10}, 0x03, 0, 0x24, 0x10, 0xC1, 0x63, 0, 0x25, 0x60, 5},
+		{"RRA zp", []byte{0x67, 0x10}, 0x41, 0, 0x25, 0x10, 0x02, 0xC2, 0, 0xA4, 0x81, 5},
+		{"SAX zp", []byte{0x87, 0x10}, 0x81, 0xC3, 0x24, 0x10, 0x00, 0x81, 0xC3, 0x24, 0x81, 3},
+		{"LAX zp", []byte{0xA7, 0x10}, 0x00, 0, 0x24, 0x10, 0x81, 0x81, 0x81, 0xA4, 0x81, 3},
+		{"DCP zp", []byte{0xC7, 0x10}, 0x81, 0, 0x24, 0x10, 0x82, 0x81, 0, 0x27, 0x81, 5},
+		{"ISC zp", []byte{0xE7, 0x10}, 0x81, 0, 0x25, 0x10, 0x7F, 0x01, 0, 0x25, 0x80, 5},
+		{"ANC #", []byte{0x0B, 0xF0}, 0x81, 0, 0x24, 0x10, 0x00, 0x80, 0, 0xA5, 0x00, 2},
+		{"ALR #", []byte{0x4B, 0x03}, 0x81, 0, 0x24, 0x10, 0x00, 0x00, 0, 0x27, 0x00, 2},
+		{"ARR #", []byte{0x6B, 0xFF}, 0xC1, 0, 0x25, 0x10, 0x00, 0xE0, 0, 0xA5, 0x00, 2},
+		{"AXS #", []byte{0xCB, 0x02}, 0x81, 0xC3, 0x24, 0x10, 0x00, 0x81, 0x7F, 0x25, 0x00, 2},
+		{"SBC # $EB", []byte{0xEB, 0x01}, 0x81, 0, 0x25, 0x10, 0x00, 0x80, 0, 0xA5, 0x00, 2},
+		{"LAX abs,Y page cross", []byte{0xBF, 0xFF, 0x00}, 0x00, 0, 0x24, 0x010F, 0x81, 0x81, 0x81, 0xA4, 0x81, 5},
+		{"SHX abs,Y", []byte{0x9E, 0x00, 0x03}, 0x00, 0xC7, 0x24, 0x0310, 0x00, 0x00, 0xC7, 0x24, 0x04, 5},
+		{"LAS abs,Y", []byte{0xBB, 0x00, 0x03}, 0x00, 0, 0x24, 0x0310, 0xF0, 0xF0, 0xF0, 0xA4, 0xF0, 4},
+		{"XAA #", []byte{0x8B, 0xFF}, 0x11, 0x0F, 0x24, 0x10, 0x00, 0x0F, 0x0F, 0x24, 0x00, 2},
+	} {
+		nes := makeTestNES(makeIdleCartridge())
+		copy(nes.ram[0x200:], test.program)
+		nes.ram[test.addr] = test.memory
+		nes.cpu.A, nes.cpu.X, nes.cpu.Y, nes.cpu.P = test.a, test.x, 0x10, test.p
+		nes.cpu.PC = 0x200
+		nes.cpu.cycles = 0
+		nes.StepInstruction()
+
+		if nes.cpu.A != test.wantA || nes.cpu.X != test.wantX || nes.cpu.P != test.wantP {
+			t.Errorf("%v: expected A:%02X X:%02X P:%02X, got A:%02X X:%02X P:%02X", test.name, test.wantA, test.wantX, test.wantP, nes.cpu.A, nes.cpu.X, nes.cpu.P)
+		}
+		if nes.ram[test.addr] != test.wantMemory {
+			t.Errorf("%v: expected $%02X at $%04X, got $%02X", test.name, test.wantMemory, test.addr, nes.ram[test.addr])
+		}
+		if nes.cpu.cycles != test.wantCycles {
+			t.Errorf("%v: expected %v cycles, got %v", test.name, test.wantCycles, nes.cpu.cycles)
+		}
+		if nes.cpu.PC != 0x200+uint16(len(test.program)) {
+			t.Errorf("%v: expected PC $%04X, got $%04X", test.name, 0x200+len(test.program), nes.cpu.PC)
+		}
+	}
+}
+
+//Indexed and indirect read-modify-write unofficials take the full cycles of their
+//official counterparts, page crossing or not
+func TestUnofficialReadModifyWrite(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		program    []byte
+		a, x, y, p byte
+		ram        map[uint16]byte //pointers and the operand
+		addr       uint16
+		wantA      byte
+		wantP      byte
+		wantMemory byte
+		wantCycles uint64
+	}{
+		{"SLO abs,X page cross", []byte{0x1F, 0xF8, 0x02}, 0x01, 0x10, 0, 0x24, map[uint16]byte{0x308: 0x40}, 0x308, 0x81, 0xA4, 0x80, 7},
+		{"RLA abs,Y", []byte{0x3B, 0x00, 0x03}, 0xFF, 0, 0x10, 0x25, map[uint16]byte{0x310: 0x80}, 0x310, 0x01, 0x25, 0x01, 7},
+		{"SRE (ind,X)", []byte{0x43, 0x20}, 0x01, 0x10, 0, 0x24, map[uint16]byte{0x30: 0x00, 0x31: 0x04, 0x400: 0x01}, 0x400, 0x01, 0x25, 0x00, 8},
+		{"RRA (ind),Y overflow", []byte{0x73, 0x40}, 0x7F, 0, 0x10, 0x24, map[uint16]byte{0x40: 0xF8, 0x41: 0x03, 0x408: 0x02}, 0x408, 0x80, 0xE4, 0x01, 8},
+		{"DCP abs", []byte{0xCF, 0x00, 0x04}, 0x00, 0, 0, 0x24, map[uint16]byte{0x400: 0x00}, 0x400, 0x00, 0x24, 0xFF, 6},
+		{"DCP zp,X equal", []byte{0xD7, 0x10}, 0x41, 0x10, 0, 0x24, map[uint16]byte{0x20: 0x42}, 0x20, 0x41, 0x27, 0x41, 6},
+		{"ISC zp,X zero", []byte{0xF7, 0x10}, 0x00, 0x10, 0, 0x25, map[uint16]byte{0x20: 0xFF}, 0x20, 0x00, 0x27, 0x00, 6},
+		{"ISC abs,X borrow", []byte{0xFF, 0x00, 0x04}, 0x01, 0x08, 0, 0x25, map[uint16]byte{0x408: 0x01}, 0x408, 0xFF, 0xA4, 0x02, 7},
+	} {
+		nes := makeTestNES(makeIdleCartridge())
+		copy(nes.ram[0x200:], test.program)
+		for addr, value := range test.ram {
+			nes.ram[addr] = value
+		}
+		nes.cpu.A, nes.cpu.X, nes.cpu.Y, nes.cpu.P = test.a, test.x, test.y, test.p
+		nes.cpu.PC = 0x200
+		nes.cpu.cycles = 0
+		nes.StepInstruction()
+
+		if nes.cpu.A != test.wantA || nes.cpu.P != test.wantP {
+			t.Errorf("%v: expected A:%02X P:%02X, got A:%02X P:%02X", test.name, test.wantA, test.wantP, nes.cpu.A, nes.cpu.P)
+		}
+		if nes.ram[test.addr] != test.wantMemory {
+			t.Errorf("%v: expected $%02X at $%04X, got $%02X", test.name, test.wantMemory, test.addr, nes.ram[test.addr])
+		}
+		if nes.cpu.cycles != test.wantCycles {
+			t.Errorf("%v: expected %v cycles, got %v", test.name, test.wantCycles, nes.cpu.cycles)
+		}
+	}
+}
+
+//C is bit 6 of the rotated result and V is bit 6 xor bit 5
+func TestArrFlags(t *testing.T) {
+	for _, test := range []struct {
+		a, p  byte
+		wantA byte
+		wantP byte
+	}{
+		{0xFF, 0x24, 0x7F, 0x25}, //C
+		{0x40, 0x24, 0x20, 0x64}, //V
+		{0x80, 0x25, 0xC0, 0xE5}, //N, V and C, carry rotated in
+		{0x01, 0x25, 0x80, 0xA4}, //bit 0 drops instead of going to C
+		{0x00, 0x24, 0x00, 0x26}, //Z
+	} {
+		nes := makeTestNES(makeIdleCartridge())
+		copy(nes.ram[0x200:], []byte{0x6B, 0xFF}) //ARR #$FF
+		nes.cpu.A, nes.cpu.P = test.a, test.p
+		nes.cpu.PC = 0x200
+		nes.StepInstruction()
+
+		if nes.cpu.A != test.wantA || nes.cpu.P != test.wantP {
+			t.Errorf("A:%02X P:%02X: expected A:%02X P:%02X, got A:%02X P:%02X", test.a, test.p, test.wantA, test.wantP, nes.cpu.A, nes.cpu.P)
+		}
+	}
+}
+
+//SHA, SHX, SHY and TAS store value & (high byte + 1), crossing a page that value
+//also replaces the high byte of the address
+func TestUnstableStoresCrossingPage(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		program   []byte
+		a, x, y   byte
+		wantAddr  uint16
+		wantValue byte
+		wantSP    byte
+	}{
+		{"SHX abs,Y", []byte{0x9E, 0xF8, 0x05}, 0x00, 0x03, 0x10, 0x0208, 0x02, 0xFD},
+		{"SHY abs,X", []byte{0x9C, 0xF8, 0x05}, 0x00, 0x10, 0x03, 0x0208, 0x02, 0xFD},
+		{"SHA abs,Y", []byte{0x9F, 0xF8, 0x05}, 0x07, 0x03, 0x10, 0x0208, 0x02, 0xFD},
+		{"SHA (ind),Y", []byte{0x93, 0x40}, 0x07, 0x03, 0x10, 0x0208, 0x02, 0xFD},
+		{"TAS abs,Y", []byte{0x9B, 0xF8, 0x05}, 0x07, 0x03, 0x10, 0x0208, 0x02, 0x03},
+		{"SHX no page cross", []byte{0x9E, 0x00, 0x05}, 0x00, 0x03, 0x10, 0x0510, 0x02, 0xFD},
+	} {
+		nes := makeTestNES(makeIdleCartridge())
+		copy(nes.ram[0x200:], test.program)
+		nes.ram[0x40], nes.ram[0x41] = 0xF8, 0x05
+		nes.cpu.A, nes.cpu.X, nes.cpu.Y = test.a, test.x, test.y
+		nes.cpu.SP = 0xFD
+		nes.cpu.PC = 0x200
+		nes.StepInstruction()
+
+		if nes.ram[test.wantAddr] != test.wantValue {
+			t.Errorf("%v: expected $%02X at $%04X, got $%02X", test.name, test.wantValue, test.wantAddr, nes.ram[test.wantAddr])
+		}
+		if test.wantAddr != 0x0608 && nes.ram[0x0608] != 0 {
+			t.Errorf("%v: expected nothing at the uncorrupted $0608, got $%02X", test.name, nes.ram[0x0608])
+		}
+		if nes.cpu.SP != test.wantSP {
+			t.Errorf("%v: expected SP $%02X, got $%02X", test.name, test.wantSP, nes.cpu.SP)
+		}
+	}
+}
+
+func TestStpHaltsUntilReset(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.ram[0x200] = 0x02
+	nes.cpu.PC = 0x200
+	nes.StepInstruction()
+
+	var halt *HaltError
+	if !errors.As(nes.Halted(), &halt) || halt.PC != 0x200 || halt.Opcode != 0x02 {
+		t.Fatalf("expected a halt on $02 at $0200, got %v", nes.Halted())
+	}
+
+	//The PPU still finishes frames and NMIs are ignored
+	nes.WriteCPU(0x2000, 0x80)
+	frame := nes.ppu.frame
+	nes.StepFrame()
+	nes.StepFrame()
+	if nes.ppu.frame != frame+2 || nes.cpu.PC != 0x200 {
+		t.Errorf("expected two frames with PC at $0200, got %v frames and PC $%04X", nes.ppu.frame-frame, nes.cpu.PC)
+	}
+
+	nes.Reset()
+	if nes.Halted() != nil || nes.cpu.PC != 0x8000 {
+		t.Errorf("expected reset to restart at $8000, got %v and PC $%04X", nes.Halted(), nes.cpu.PC)
+	}
+}
+
+//Idle cartridge with the NMI handler at $9000 and IRQ/BRK at $A000
+func makeInterruptTestNES() *NES {
+	cart := makeIdleCartridge()
+	cart.prg[0x7FFA], cart.prg[0x7FFB] = 0x00, 0x90
+	cart.prg[0x7FFE], cart.prg[0x7FFF] = 0x00, 0xA0
+	nes := makeTestNES(cart)
+	nes.cpu.PC = 0x200
+	nes.cpu.SP = 0xFD
+	return nes
+}
+
+func TestBrkIgnoresIFlag(t *testing.T) {
+	nes := makeInterruptTestNES()
+	nes.ram[0x200] = 0x00 //BRK
+	nes.cpu.P = 0x24
+	if cycles := nes.cpu.run(); cycles != 7 {
+		t.Errorf("expected 7 cycles, got %v", cycles)
+	}
+
+	returnAddress := uint16(nes.ram[0x1FD])<<8 | uint16(nes.ram[0x1FC])
+	if nes.cpu.PC != 0xA000 || returnAddress != 0x202 {
+		t.Errorf("expected the handler at $A000 returning to $0202, got $%04X returning to $%04X", nes.cpu.PC, returnAddress)
+	}
+	if nes.ram[0x1FB] != 0x34 || nes.cpu.isFlagSet(BFlag) {
+		t.Errorf("expected B only in the pushed P, pushed $%02X, P $%02X", nes.ram[0x1FB], nes.cpu.P)
+	}
+}
+
+func TestIRQRespectsIFlagAndNMIDoesNot(t *testing.T) {
+	nes := makeInterruptTestNES()
+	copy(nes.ram[0x200:], []byte{0xEA, 0xEA}) //NOP, NOP
+	nes.cpu.P = 0x24
+	nes.cpu.assertIRQ(irqSourceMapper)
+	nes.cpu.run()
+	if nes.cpu.PC != 0x201 {
+		t.Fatalf("IRQ taken with I set, PC $%04X", nes.cpu.PC)
+	}
+
+	//Raised after the poll, the next instruction still runs first
+	nes.cpu.nmiRequested = true
+	nes.cpu.run()
+	if cycles := nes.cpu.run(); cycles != 7 || nes.cpu.PC != 0x9000 {
+		t.Errorf("expected the NMI handler after 7 cycles, got $%04X after %v", nes.cpu.PC, cycles)
+	}
+	if nes.ram[0x1FB] != 0x24 {
+		t.Errorf("expected P pushed without B, got $%02X", nes.ram[0x1FB])
+	}
+}
+
+func TestIFlagChangesArePolledLate(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		program []byte
+		steps int //instructions before the IRQ
+		pushedP byte
+	}{
+		{"CLI", []byte{0x58, 0xEA}, 2, 0x20},
+		{"CLI SEI", []byte{0x58, 0x78}, 2, 0x24},
+		{"PLP", []byte{0x28, 0xEA}, 2, 0x20},
+		{"RTI", []byte{0x40}, 1, 0x20},
+	} {
+		nes := makeInterruptTestNES()
+		copy(nes.ram[0x200:], test.program)
+		copy(nes.ram[0x300:], []byte{0xEA, 0xEA})
+		//P for PLP and RTI, then $0300 for RTI
+		nes.ram[0x1FD], nes.ram[0x1FE], nes.ram[0x1FF] = 0x20, 0x00, 0x03
+		nes.cpu.SP = 0xFC
+		nes.cpu.P = 0x24
+		nes.cpu.assertIRQ(irqSourceMapper)
+
+		for i := 0; i < test.steps; i++ {
+			if nes.cpu.run(); nes.cpu.PC == 0xA000 {
+				t.Fatalf("%v: IRQ taken after %v instructions", test.name, i+1)
+			}
+		}
+		nes.cpu.run()
+		if nes.cpu.PC != 0xA000 || nes.ram[0x100|uint16(nes.cpu.SP+1)] != test.pushedP {
+			t.Errorf("%v: expected the IRQ handler with $%02X pushed, got PC $%04X with $%02X", test.name,
+				test.pushedP, nes.cpu.PC, nes.ram[0x100|uint16(nes.cpu.SP+1)])
+		}
+	}
+}
+
+func TestNMIHijacksBrk(t *testing.T) {
+	for _, test := range []struct {
+		dot int //on scanline 240, VBlank and NMI start at dot 1 of 241
+		pc uint16
+		pushedP byte
+	}{
+		{328, 0xA000, 0x30}, //NMI on the 5th cycle, after the vector fetch started
+		{331, 0x9000, 0x30}, //NMI on the 4th cycle, hijacked
+	} {
+		nes := makeInterruptTestNES()
+		nes.ram[0x200] = 0x00 //BRK
+		nes.cpu.P = 0x20
+		nes.WriteCPU(0x2000, 0x80)
+		nes.ppu.scanline, nes.ppu.cycles = 240, test.dot
+		nes.StepInstruction()
+		if nes.cpu.PC != test.pc || nes.ram[0x1FB] != test.pushedP {
+			t.Errorf("dot %v: expected $%04X with $%02X pushed, got $%04X with $%02X", test.dot, test.pc, test.pushedP, nes.cpu.PC, nes.ram[0x1FB])
+		}
+	}
+}
+
+func TestRunReturnsElapsedCycles(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		pc uint16
+		program []byte
+		p byte
+		cycles int
+	}{
+		{"branch not taken", 0x200, []byte{0xD0, 0x02}, 0x26, 2}, //BNE with Z set
+		{"branch taken", 0x200, []byte{0xD0, 0x02}, 0x24, 3},
+		{"branch across a page", 0x2FC, []byte{0xD0, 0x10}, 0x24, 4},
+		{"same page", 0x200, []byte{0xBD, 0x00, 0x03}, 0x24, 4}, //LDA $0300,X
+		{"page crossed", 0x200, []byte{0xBD, 0xFF, 0x02}, 0x24, 5}, //LDA $02FF,X
+		{"store never pays", 0x200, []byte{0x9D, 0xFF, 0x02}, 0x24, 5}, //STA $02FF,X
+	} {
+		nes := makeTestNES(makeIdleCartridge())
+		copy(nes.ram[test.pc:], test.program)
+		nes.cpu.PC = test.pc
+		nes.cpu.P = test.p
+		nes.cpu.X = 1
+		apuCycles := nes.apu.cycles
+		if cycles := nes.StepInstruction(); cycles != test.cycles || nes.apu.cycles-apuCycles != uint64(cycles) {
+			t.Errorf("%v: expected %v cycles, got %v with %v APU steps", test.name, test.cycles, cycles, nes.apu.cycles-apuCycles)
+		}
+	}
+}
+
+func TestOamDmaStallsCpu(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	copy(nes.ram[0x200:], []byte{0x8D, 0x14, 0x40, 0xEA}) //STA $4014, NOP
+	nes.cpu.PC = 0x200
+	nes.StepInstruction()
+
+	stall := nes.StepInstruction()
+	if stall != 513 && stall != 514 || nes.cpu.PC != 0x203 {
+		t.Errorf("expected a 513 or 514 cycle stall before the NOP, got %v at $%04X", stall, nes.cpu.PC)
+	}
+	if cycles := nes.StepInstruction(); cycles != 2 || nes.cpu.PC != 0x204 {
+		t.Errorf("expected the NOP after the stall, got %v cycles at $%04X", cycles, nes.cpu.PC)
+	}
+}
+
+func TestReadModifyWriteReadsOnce(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	copy(nes.ram[0x200:], []byte{0xEF, 0x07, 0x20}) //ISC $2007
+	nes.cpu.PC = 0x200
+	nes.ppu.v = 0x2000
+	nes.StepInstruction()
+
+	//One read and the two writes each move the PPU address on by 1
+	if nes.ppu.v != 0x2003 {
+		t.Errorf("expected the PPU address at $2003, got $%04X", nes.ppu.v)
+	}
+
+	for opcode, expected := range map[byte]bool{0x0A: false, 0x4A: false, 0x6A: false, 0x2A: false, 0x0E: true, 0xEF: true, 0xA9: false} {
+		if got := isReadModifyWrite(opcode); got != expected {
+			t.Errorf("$%02X: expected read-modify-write %v, got %v", opcode, expected, got)
+		}
+	}
+}
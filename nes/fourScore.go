@@ -0,0 +1,123 @@
+package nes
+
+//https://wiki.nesdev.com/w/index.php/Four_player_adapters
+//NES Four Score, controllers 1 and 3 read in series through $4016, 2 and 4 through $4017
+type FourScore struct {
+	controllers [4]*GameController
+	strobe bool
+	reads [2]int //since the strobe, per port
+}
+
+//Which four player adapter ConnectMultitap plugs in
+type Multitap int
+
+const (
+	MultitapNone Multitap = iota
+	MultitapFourScore //NES Four Score across both ports, with a signature
+	MultitapFamicom //Famicom expansion port adapter, controllers 3 and 4 on D1
+)
+
+//Read after both pads, LSB first, so games can tell the Four Score is there
+var fourScoreSignatures = [2]byte{0x08, 0x04}
+
+func MakeNewFourScore(controllers [4]*GameController) *FourScore {
+	return &FourScore{
+		controllers: controllers,
+	}
+}
+
+func (f *FourScore) Strobe(value byte) {
+	f.strobe = value&1 == 1
+	if f.strobe {
+		f.reads = [2]int{}
+	}
+	for _, controller := range f.controllers {
+		controller.Strobe(value)
+	}
+}
+
+func (f *FourScore) Latch() {
+	for _, controller := range f.controllers {
+		controller.Latch()
+	}
+}
+
+func (f *FourScore) read(port int) byte {
+	if f.strobe {
+		return f.controllers[port].Read()
+	}
+
+	n := f.reads[port]
+	if n < 24 {
+		f.reads[port]++
+	}
+	switch {
+	case n < 8:
+		return f.controllers[port].Read()
+	case n < 16:
+		return f.controllers[port+2].Read()
+	case n < 24:
+		return fourScoreSignatures[port] >> uint(n-16) & 1
+	default:
+		return 1
+	}
+}
+
+func (f *FourScore) saveState(s *stateWriter) {
+	s.write(f.strobe)
+	s.writeInt(f.reads[0], f.reads[1])
+}
+
+func (f *FourScore) loadState(s *stateReader) {
+	s.read(&f.strobe)
+	s.readInt(&f.reads[0], &f.reads[1])
+}
+
+//One side of the Four Score as seen by a port, the adapter is strobed and
+//latched through the Port1 side only
+type fourScorePort struct {
+	fourScore *FourScore
+	port int
+}
+
+func (p fourScorePort) Strobe(value byte) {
+	if p.port == Port1 {
+		p.fourScore.Strobe(value)
+	}
+}
+
+func (p fourScorePort) Latch() {
+	if p.port == Port1 {
+		p.fourScore.Latch()
+	}
+}
+
+func (p fourScorePort) Read() byte {
+	return p.fourScore.read(p.port)
+}
+
+//Famicom four player adapter, the Famicom's own pads stay in the ports and
+//controllers 3 and 4 come in through the expansion port on D1
+type famicomAdapter struct {
+	controllers [2]*GameController
+}
+
+func (a *famicomAdapter) Strobe(value byte) {
+	for _, controller := range a.controllers {
+		controller.Strobe(value)
+	}
+}
+
+func (a *famicomAdapter) Latch() {
+	for _, controller := range a.controllers {
+		controller.Latch()
+	}
+}
+
+func (a *famicomAdapter) Read() byte {
+	return a.ReadExpansion(Port1)
+}
+
+func (a *famicomAdapter) ReadExpansion(port int) byte {
+	return a.controllers[port].Read() << 1
+}
@@ -0,0 +1,67 @@
+package nes
+
+import (
+	"testing"
+)
+
+func readPort(nes *NES, port int, n int) []byte {
+	var bits []byte
+	for i := 0; i < n; i++ {
+		bits = append(bits, nes.ReadCPU(0x4016+uint16(port))&0x03)
+	}
+	return bits
+}
+
+func bitsOf(mask byte) []byte {
+	var bits []byte
+	for i := uint(0); i < 8; i++ {
+		bits = append(bits, mask>>i&1)
+	}
+	return bits
+}
+
+func TestFourScore(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.ConnectMultitap(MultitapFourScore)
+	for i, mask := range []byte{ButtonA, ButtonB, ButtonStart, ButtonRight} {
+		nes.SetButtons(i, mask)
+	}
+	nes.WriteCPU(0x4016, 1)
+	nes.WriteCPU(0x4016, 0)
+
+	want := [2][]byte{}
+	want[0] = append(append(append(bitsOf(ButtonA), bitsOf(ButtonStart)...), bitsOf(0x08)...), 1)
+	want[1] = append(append(append(bitsOf(ButtonB), bitsOf(ButtonRight)...), bitsOf(0x04)...), 1)
+	for port := range want {
+		if got := readPort(nes, port, 25); string(got) != string(want[port]) {
+			t.Errorf("port %v: expected %v, got %v", port+1, want[port], got)
+		}
+	}
+
+	nes.ConnectMultitap(MultitapNone)
+	nes.WriteCPU(0x4016, 1)
+	nes.WriteCPU(0x4016, 0)
+	if got := readPort(nes, 1, 8); string(got) != string(bitsOf(ButtonB)) {
+		t.Errorf("without the multitap port 2 should read pad 2, got %v", got)
+	}
+}
+
+func TestFamicomFourPlayer(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.ConnectMultitap(MultitapFamicom)
+	for i, mask := range []byte{ButtonA, ButtonB, ButtonStart, ButtonRight} {
+		nes.SetButtons(i, mask)
+	}
+	nes.WriteCPU(0x4016, 1)
+	nes.WriteCPU(0x4016, 0)
+
+	for port, masks := range [2][2]byte{{ButtonA, ButtonStart}, {ButtonB, ButtonRight}} {
+		var want []byte
+		for i, bit := range bitsOf(masks[0]) {
+			want = append(want, bit|bitsOf(masks[1])[i]<<1)
+		}
+		if got := readPort(nes, port, 8); string(got) != string(want) {
+			t.Errorf("port %v: expected %v, got %v", port+1, want, got)
+		}
+	}
+}
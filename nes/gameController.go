@@ -0,0 +1,160 @@
+package nes
+
+type GameController struct {
+	buttonStates byte // A-B-Se-St-U-D-L-R https://wiki.nesdev.com/w/index.php/Controller_reading_code
+	strobe bool
+
+	//What the player holds, turbo and macros are worked out from these every frame
+	held byte
+	turboHeld byte
+	turboRate int //frames pressed, then as many released
+	turboFrame int
+	macro []byte //masks still to play, one per frame
+}
+
+//A named sequence of button masks played one per frame, e.g. a fireball motion
+type Macro struct {
+	Name string
+	Frames []byte
+}
+
+//Turbo buttons go down for this many frames and up for as many, 15 presses a second on NTSC
+const DefaultTurboRate = 2
+
+//Longest macro a save state may hold, guards against reading garbage lengths
+const maxMacroFrames = 1 << 16
+//https://wiki.nesdev.com/w/index.php/Standard_controller
+const(
+	controllerButtonA = 0
+	controllerButtonB = 1
+	controllerButtonSelect = 2
+	controllerButtonStart = 3
+	controllerButtonUp = 4
+	controllerButtonDown = 5
+	controllerButtonLeft = 6
+	controllerButtonRight = 7
+)
+
+
+//Masks for SetButtons
+const (
+	ButtonA      = 1 << controllerButtonA
+	ButtonB      = 1 << controllerButtonB
+	ButtonSelect = 1 << controllerButtonSelect
+	ButtonStart  = 1 << controllerButtonStart
+	ButtonUp     = 1 << controllerButtonUp
+	ButtonDown   = 1 << controllerButtonDown
+	ButtonLeft   = 1 << controllerButtonLeft
+	ButtonRight  = 1 << controllerButtonRight
+)
+
+func MakeNewGameController() *GameController {
+	return &GameController {
+		buttonStates: 0,
+		strobe: false,
+		turboRate: DefaultTurboRate,
+	}
+}
+func (g *GameController) Strobe(value byte) {
+	g.strobe = value&1 == 1
+}
+
+func (g *GameController) Read() byte {
+	if g.strobe {
+		buttonAState := g.buttonStates>>7
+		return buttonAState
+	} else {
+		btnState := (g.buttonStates >> 7) //TODO-check
+		g.buttonStates <<= 1
+		g.buttonStates |= btnState
+		return btnState
+	}
+}
+
+func (g *GameController) pressButton(button byte) {
+	buttonBit := byte(7)-button 
+	g.buttonStates |= (1<<buttonBit)  	
+}
+
+func (g *GameController) releaseButton(button byte) {
+	buttonBit := byte(7)-button 
+	mask := byte(0xFF)^(1<<buttonBit)
+	g.buttonStates &= mask
+}
+
+func (g *GameController) setButtons(mask byte) {
+	g.held = mask
+	g.update()
+}
+
+func (g *GameController) setTurboButtons(mask byte) {
+	if mask == 0 {
+		g.turboFrame = 0
+	}
+	g.turboHeld = mask
+	g.update()
+}
+
+func (g *GameController) setTurboRate(frames int) {
+	if frames < 1 {
+		frames = DefaultTurboRate
+	}
+	g.turboRate = frames
+	g.update()
+}
+
+func (g *GameController) playMacro(macro Macro) {
+	g.macro = append([]byte(nil), macro.Frames...)
+	g.update()
+}
+
+//Turbo and macros only move on frame boundaries so a run replays the same
+//from the same held buttons
+func (g *GameController) Latch() {
+	if g.turboHeld != 0 {
+		g.turboFrame++
+	}
+	if len(g.macro) > 0 {
+		g.macro = g.macro[1:]
+	}
+	g.update()
+}
+
+func (g *GameController) update() {
+	mask := g.held
+	if g.turboFrame/g.turboRate%2 == 0 {
+		mask |= g.turboHeld
+	}
+	if len(g.macro) > 0 {
+		mask |= g.macro[0]
+	}
+
+	for button := byte(0); button < 8; button++ {
+		if mask&(1<<button) != 0 {
+			g.pressButton(button)
+		} else {
+			g.releaseButton(button)
+		}
+	}
+}
+
+func (g *GameController) saveState(s *stateWriter) {
+	s.write(g.buttonStates, g.strobe, g.held, g.turboHeld)
+	s.writeInt(g.turboRate, g.turboFrame, len(g.macro))
+	s.write(g.macro)
+}
+
+func (g *GameController) loadState(s *stateReader) {
+	var macroLength int
+	s.read(&g.buttonStates, &g.strobe, &g.held, &g.turboHeld)
+	s.readInt(&g.turboRate, &g.turboFrame, &macroLength)
+	if s.err != nil {
+		return
+	}
+	if g.turboRate < 1 || macroLength < 0 || macroLength > maxMacroFrames {
+		s.err = ErrStateCorrupt
+		return
+	}
+	g.macro = make([]byte, macroLength)
+	s.read(g.macro)
+}
@@ -0,0 +1,105 @@
+package nes
+
+import (
+	"fmt"
+)
+
+type Mapper interface {
+	Read(addr uint16) byte
+	Write(addr uint16, value byte)
+	//1K page of memory backing nametable 0-3 at $2000-$2FFF
+	NametablePage(table byte) []byte
+	//Bank registers and latches, see SaveState
+	saveState(s *stateWriter)
+	loadState(s *stateReader)
+}
+
+//Implemented by mappers that watch the PPU address bus, e.g. to clock
+//a scanline counter from A12
+type PPUAddressObserver interface {
+	ObservePPUAddress(addr uint16)
+}
+
+//Nametable mirroring modes
+//https://wiki.nesdev.com/w/index.php/Mirroring#Nametable_Mirroring
+const (
+	mirrorHorizontal = 0
+	mirrorVertical = 1
+	mirrorSingleScreenLow = 2
+	mirrorSingleScreenHigh = 3
+	mirrorFourScreen = 4
+)
+
+//Discrete logic boards where both the CPU and the ROM drive the data bus on writes.
+//Some ROM databases disagree per board, so these are only defaults.
+//https://wiki.nesdev.com/w/index.php/Bus_conflict
+var boardHasBusConflicts = map[uint16]bool{
+	2:  true,  //UNROM
+	3:  true,  //CNROM
+	7:  false, //ANROM, AOROM
+	66: true,  //GNROM, MHROM
+}
+
+//Boards that fix a 16K bank to the end of PRG ROM at $C000, a smaller rom has nothing to put there
+var boardFixedPrgWindow = map[uint16]int{
+	1: 0x4000, //MMC1 PRG mode 3
+	2: 0x4000, //UNROM
+	4: 0x4000, //MMC3 second-last and last 8K banks
+}
+
+//NES 2.0 submapper 1 and 2 settle it for mappers 2, 3 and 7
+func hasBusConflicts(cart *Cartridge) bool {
+	mapperId := cart.getMapperId()
+	isSettledBySubmapper := mapperId == 2 || mapperId == 3 || mapperId == 7
+	if isSettledBySubmapper {
+		switch cart.getSubmapperId() {
+		case 1:
+			return false
+		case 2:
+			return true
+		}
+	}
+	return boardHasBusConflicts[mapperId]
+}
+
+//Boards that latch writes to ROM and can have bus conflicts
+type busConflictMapper interface {
+	setBusConflicts(enabled bool)
+}
+
+//Overrides the board default from the header for roms a database marks differently,
+//only the discrete boards, mappers 2, 3, 7 and 66, have bus conflicts to switch
+func (nes *NES) SetBusConflicts(enabled bool) {
+	if mapper, ok := nes.mapper.(busConflictMapper); ok {
+		mapper.setBusConflicts(enabled)
+	}
+}
+
+//The written value is ANDed with the ROM byte at the same address
+func applyBusConflict(mapper Mapper, addr uint16, value byte) byte {
+	return value & mapper.Read(addr)
+}
+
+func MakeNewMapper(nes *NES) (Mapper, error) {
+	mapperId := nes.cart.getMapperId()
+
+	switch mapperId {
+
+	case 0:
+		return MakeNewMapper0(nes), nil
+	case 1:
+		return MakeNewMapper1(nes), nil
+	case 2:
+		return MakeNewMapper2(nes, hasBusConflicts(nes.cart)), nil
+	case 3:
+		return MakeNewMapper3(nes, hasBusConflicts(nes.cart)), nil
+	case 4:
+		return MakeNewMapper4(nes), nil
+	case 7:
+		return MakeNewMapper7(nes, hasBusConflicts(nes.cart)), nil
+	case 66:
+		return MakeNewMapper66(nes, hasBusConflicts(nes.cart)), nil
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedMapper, mapperId)
+}
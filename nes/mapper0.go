@@ -0,0 +1,54 @@
+package nes
+
+type Mapper0 struct {
+	nes *NES
+}
+//https://wiki.nesdev.com/w/index.php/INES_Mapper_000
+func (mapper Mapper0) Read(addr uint16) byte {
+
+	switch {
+	case addr < 0x2000:
+		return mapper.nes.cart.chr[addr]
+	case addr >= 0x6000 && addr < 0x8000:
+		return mapper.nes.cart.readWram(addr-0x6000, mapper.nes.openBus)
+	case addr >= 0x8000:
+		a := int(addr-0x8000) % len(mapper.nes.cart.prg)
+		return mapper.nes.cart.prg[a]	
+	default:
+		mapper.nes.diagnose(addr, "mapper read outside the cartridge")
+	}
+	
+	return mapper.nes.openBus
+}
+
+func (mapper Mapper0) Write(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		mapper.nes.cart.writeChr(int(addr), value)
+	case addr >= 0x6000 && addr < 0x8000:
+		mapper.nes.cart.writeWram(addr-0x6000, value)
+	//Rom is read-only.
+	case addr >= 0x8000:
+		
+	default:
+		mapper.nes.diagnose(addr, "mapper write of $%02X outside the cartridge", value)
+
+	}	
+}
+
+func (mapper Mapper0) Mirroring() byte {
+	return mapper.nes.cart.getNametableMirroring()
+}
+
+func (mapper Mapper0) NametablePage(table byte) []byte {
+	return mirroredNametablePage(mapper.nes, mapper.Mirroring(), table)
+}
+
+func MakeNewMapper0(nes *NES) Mapper0 {
+	return Mapper0{nes: nes}
+}
+
+//No registers
+func (mapper Mapper0) saveState(s *stateWriter) {}
+
+func (mapper Mapper0) loadState(s *stateReader) {}
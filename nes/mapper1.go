@@ -0,0 +1,178 @@
+package nes
+
+//MMC1
+//https://wiki.nesdev.com/w/index.php/MMC1
+type Mapper1 struct {
+	nes *NES
+
+	shiftRegister byte
+	writeCount    byte
+	lastWriteCycle uint64
+
+	control  byte
+	chrBank0 byte
+	chrBank1 byte
+	prgBank  byte
+
+	prgOffsets [2]int //$8000 and $C000 16K windows
+	chrOffsets [2]int //$0000 and $1000 4K windows
+}
+
+func MakeNewMapper1(nes *NES) *Mapper1 {
+	mapper := Mapper1{nes: nes}
+	//Power-up state fixes the last bank at $C000
+	mapper.writeControl(0x0C)
+	return &mapper
+}
+
+func (mapper *Mapper1) Read(addr uint16) byte {
+	cart := mapper.nes.cart
+
+	switch {
+	case addr < 0x2000:
+		bank := addr / 0x1000
+		offset := mapper.chrOffsets[bank] + int(addr%0x1000)
+		return cart.chr[offset%len(cart.chr)]
+	case addr >= 0x6000 && addr < 0x8000:
+		if !mapper.isPrgRamEnabled() {
+			mapper.nes.diagnose(addr, "read from disabled PRG RAM")
+			return mapper.nes.openBus
+		}
+		return cart.readWram(addr-0x6000, mapper.nes.openBus)
+	case addr >= 0x8000:
+		bank := (addr - 0x8000) / 0x4000
+		offset := mapper.prgOffsets[bank] + int(addr%0x4000)
+		return cart.prg[offset%len(cart.prg)]
+	default:
+		mapper.nes.diagnose(addr, "mapper read outside the cartridge")
+	}
+
+	return mapper.nes.openBus
+}
+
+func (mapper *Mapper1) Write(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		mapper.nes.cart.writeChr(mapper.chrOffsets[addr/0x1000] + int(addr%0x1000), value)
+	case addr >= 0x6000 && addr < 0x8000:
+		if mapper.isPrgRamEnabled() {
+			mapper.nes.cart.writeWram(addr-0x6000, value)
+		}
+	case addr >= 0x8000:
+		mapper.writeLoadRegister(addr, value)
+	default:
+		mapper.nes.diagnose(addr, "mapper write of $%02X outside the cartridge", value)
+	}
+}
+
+//Writes are done serially, one bit per write, LSB first.
+//The 5th write copies the shift register into the register selected by bits 13-14 of addr.
+func (mapper *Mapper1) writeLoadRegister(addr uint16, value byte) {
+	//The MMC1 ignores the second of two writes on consecutive cycles, the result
+	//of read-modify-write instructions after the unmodified value
+	var cycle uint64
+	if mapper.nes.cpu != nil {
+		cycle = mapper.nes.cpu.writeCycle
+	}
+	isConsecutiveWrite := cycle == mapper.lastWriteCycle+1
+	mapper.lastWriteCycle = cycle
+	if isConsecutiveWrite {
+		return
+	}
+
+	if value&0x80 != 0 {
+		mapper.shiftRegister = 0
+		mapper.writeCount = 0
+		mapper.writeControl(mapper.control | 0x0C)
+		return
+	}
+
+	mapper.shiftRegister |= (value & 1) << mapper.writeCount
+	mapper.writeCount++
+	if mapper.writeCount < 5 {
+		return
+	}
+
+	data := mapper.shiftRegister
+	switch (addr >> 13) & 3 {
+	case 0: //$8000-$9FFF
+		mapper.writeControl(data)
+	case 1: //$A000-$BFFF
+		mapper.chrBank0 = data
+	case 2: //$C000-$DFFF
+		mapper.chrBank1 = data
+	case 3: //$E000-$FFFF
+		mapper.prgBank = data
+	}
+	mapper.updateOffsets()
+
+	mapper.shiftRegister = 0
+	mapper.writeCount = 0
+}
+
+func (mapper *Mapper1) writeControl(value byte) {
+	mapper.control = value & 0x1F
+	mapper.updateOffsets()
+}
+
+func (mapper *Mapper1) updateOffsets() {
+	prgMode := (mapper.control >> 2) & 3
+	bank := int(mapper.prgBank & 0x0F)
+	lastBank := len(mapper.nes.cart.prg)/0x4000 - 1
+
+	switch prgMode {
+	case 0, 1: //switch 32K at $8000, ignoring low bit of bank number
+		mapper.prgOffsets[0] = (bank & 0x0E) * 0x4000
+		mapper.prgOffsets[1] = (bank | 0x01) * 0x4000
+	case 2: //fix first bank at $8000, switch 16K bank at $C000
+		mapper.prgOffsets[0] = 0
+		mapper.prgOffsets[1] = bank * 0x4000
+	case 3: //fix last bank at $C000, switch 16K bank at $8000
+		mapper.prgOffsets[0] = bank * 0x4000
+		mapper.prgOffsets[1] = lastBank * 0x4000
+	}
+
+	if mapper.isChr4KMode() {
+		mapper.chrOffsets[0] = int(mapper.chrBank0) * 0x1000
+		mapper.chrOffsets[1] = int(mapper.chrBank1) * 0x1000
+	} else { //switch 8K at a time, ignoring low bit of bank number
+		mapper.chrOffsets[0] = int(mapper.chrBank0&0x1E) * 0x1000
+		mapper.chrOffsets[1] = int(mapper.chrBank0|0x01) * 0x1000
+	}
+}
+
+func (mapper *Mapper1) isChr4KMode() bool {
+	return (mapper.control>>4)&1 == 1
+}
+
+func (mapper *Mapper1) isPrgRamEnabled() bool {
+	return (mapper.prgBank>>4)&1 == 0
+}
+
+func (mapper *Mapper1) Mirroring() byte {
+	switch mapper.control & 3 {
+	case 0:
+		return mirrorSingleScreenLow
+	case 1:
+		return mirrorSingleScreenHigh
+	case 2:
+		return mirrorVertical
+	default:
+		return mirrorHorizontal
+	}
+}
+
+func (mapper *Mapper1) NametablePage(table byte) []byte {
+	return mirroredNametablePage(mapper.nes, mapper.Mirroring(), table)
+}
+
+func (mapper *Mapper1) saveState(s *stateWriter) {
+	s.write(mapper.shiftRegister, mapper.writeCount, mapper.lastWriteCycle,
+		mapper.control, mapper.chrBank0, mapper.chrBank1, mapper.prgBank)
+}
+
+func (mapper *Mapper1) loadState(s *stateReader) {
+	s.read(&mapper.shiftRegister, &mapper.writeCount, &mapper.lastWriteCycle,
+		&mapper.control, &mapper.chrBank0, &mapper.chrBank1, &mapper.prgBank)
+	mapper.updateOffsets()
+}
@@ -0,0 +1,199 @@
+package nes
+
+import (
+	"testing"
+)
+
+//Fills every 16K PRG bank and every 4K CHR bank with its own bank number,
+//no CHR banks gives 8K of CHR RAM
+func makeTestCartridge(mapperId byte, prgBanks int, chrBanks int) *Cartridge {
+	prg := make([]byte, prgBanks*0x4000)
+	for i := range prg {
+		prg[i] = byte(i / 0x4000)
+	}
+	chr := make([]byte, chrBanks*0x2000)
+	for i := range chr {
+		chr[i] = byte(i / 0x1000)
+	}
+
+	cart := &Cartridge{
+		header: INESHeader{
+			MagicNumber: iNESMagicNumber,
+			PrgRomSize: byte(prgBanks),
+			ChrRomSize: byte(chrBanks),
+			Flag6: (mapperId & 0x0F) << 4,
+			Flag7: mapperId & 0xF0,
+		},
+		prg: prg,
+		chr: chr,
+		wram: make([]byte, 0x2000),
+	}
+	if chrBanks == 0 {
+		cart.chr = make([]byte, 0x2000)
+		cart.hasChrRam = true
+	}
+	return cart
+}
+
+//MakeNewNES plus opts, panics so helpers without a *testing.T can use it
+func makeTestNES(cart *Cartridge, opts ...Option) *NES {
+	nes, err := MakeNewNES(cart)
+	if err != nil {
+		panic(err)
+	}
+	for _, opt := range opts {
+		opt(nes)
+	}
+	return nes
+}
+
+//Shifts value into the MMC1 one bit per write, each on its own instruction
+func writeMMC1Register(nes *NES, addr uint16, value byte) {
+	for i := 0; i < 5; i++ {
+		nes.cpu.writeCycle += 2
+		nes.Write(addr, value>>i)
+	}
+}
+
+func TestMapper1PowerUpFixesLastBank(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(1, 8, 2))
+
+	if got := nes.Read(0x8000); got != 0 {
+		t.Errorf("$8000: expected bank 0, got %v", got)
+	}
+	if got := nes.Read(0xC000); got != 7 {
+		t.Errorf("$C000: expected bank 7, got %v", got)
+	}
+}
+
+func TestMapper1PrgBankModes(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(1, 8, 2))
+
+	//mode 3: switch $8000, fix last bank at $C000
+	writeMMC1Register(nes, 0xE000, 5)
+	if got := nes.Read(0x8000); got != 5 {
+		t.Errorf("mode 3 $8000: expected bank 5, got %v", got)
+	}
+	if got := nes.Read(0xFFFF); got != 7 {
+		t.Errorf("mode 3 $C000: expected bank 7, got %v", got)
+	}
+
+	//mode 2: fix first bank at $8000, switch $C000
+	writeMMC1Register(nes, 0x8000, 0x08)
+	if got := nes.Read(0x8000); got != 0 {
+		t.Errorf("mode 2 $8000: expected bank 0, got %v", got)
+	}
+	if got := nes.Read(0xC000); got != 5 {
+		t.Errorf("mode 2 $C000: expected bank 5, got %v", got)
+	}
+
+	//mode 0: 32K switching ignores the low bit
+	writeMMC1Register(nes, 0x8000, 0x00)
+	if got := nes.Read(0x8000); got != 4 {
+		t.Errorf("mode 0 $8000: expected bank 4, got %v", got)
+	}
+	if got := nes.Read(0xC000); got != 5 {
+		t.Errorf("mode 0 $C000: expected bank 5, got %v", got)
+	}
+}
+
+func TestMapper1ResetBit(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(1, 8, 2))
+	writeMMC1Register(nes, 0x8000, 0x00)
+
+	//Partial load followed by a reset write must discard the shifted bits
+	nes.cpu.cycles++
+	nes.Write(0xE000, 1)
+	nes.cpu.cycles++
+	nes.Write(0xE000, 0x80)
+	writeMMC1Register(nes, 0xE000, 2)
+
+	if got := nes.Read(0x8000); got != 2 {
+		t.Errorf("$8000: expected bank 2, got %v", got)
+	}
+	if got := nes.Read(0xC000); got != 7 {
+		t.Errorf("reset should restore mode 3, $C000 got bank %v", got)
+	}
+}
+
+//INC $FFFF on $FF resets the shift register like Bill & Ted does, the $00
+//written on the next cycle is ignored
+func TestMapper1IgnoresConsecutiveWrites(t *testing.T) {
+	cart := makeTestCartridge(1, 8, 2)
+	cart.prg[len(cart.prg)-1] = 0xFF
+	nes := makeTestNES(cart)
+	nes.Write(0xE000, 1)
+	nes.Write(0xE000, 1)
+
+	copy(nes.ram[0x200:], []byte{0xEE, 0xFF, 0xFF}) //INC $FFFF
+	nes.cpu.PC = 0x200
+	nes.StepInstruction()
+
+	mapper := nes.mapper.(*Mapper1)
+	if mapper.writeCount != 0 || mapper.shiftRegister != 0 {
+		t.Errorf("expected a reset shift register, got %v writes of $%02X", mapper.writeCount, mapper.shiftRegister)
+	}
+}
+
+func TestMapper1ChrBankModes(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(1, 2, 4))
+
+	//8K mode
+	writeMMC1Register(nes, 0x8000, 0x0C)
+	writeMMC1Register(nes, 0xA000, 5)
+	if got := nes.ppu.Read(0x0000); got != 4 {
+		t.Errorf("8K mode $0000: expected bank 4, got %v", got)
+	}
+	if got := nes.ppu.Read(0x1000); got != 5 {
+		t.Errorf("8K mode $1000: expected bank 5, got %v", got)
+	}
+
+	//4K mode
+	writeMMC1Register(nes, 0x8000, 0x1C)
+	writeMMC1Register(nes, 0xA000, 3)
+	writeMMC1Register(nes, 0xC000, 6)
+	if got := nes.ppu.Read(0x0000); got != 3 {
+		t.Errorf("4K mode $0000: expected bank 3, got %v", got)
+	}
+	if got := nes.ppu.Read(0x1000); got != 6 {
+		t.Errorf("4K mode $1000: expected bank 6, got %v", got)
+	}
+}
+
+func TestMapper1Mirroring(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(1, 2, 2))
+
+	expected := []byte{mirrorSingleScreenLow, mirrorSingleScreenHigh, mirrorVertical, mirrorHorizontal}
+	for i, mirroring := range expected {
+		writeMMC1Register(nes, 0x8000, 0x0C|byte(i))
+		if got := nes.mapper.(*Mapper1).Mirroring(); got != mirroring {
+			t.Errorf("control %v: expected mirroring %v, got %v", i, mirroring, got)
+		}
+	}
+
+	//Single screen maps every nametable onto the same page
+	writeMMC1Register(nes, 0x8000, 0x0D)
+	nes.ppu.Write(0x2000, 0xAB)
+	if got := nes.ppu.Read(0x2C00); got != 0xAB {
+		t.Errorf("single screen: expected $AB at $2C00, got $%X", got)
+	}
+}
+
+func TestMapper1PrgRamEnable(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(1, 2, 2))
+
+	nes.Write(0x6000, 0x42)
+	if got := nes.Read(0x6000); got != 0x42 {
+		t.Errorf("enabled PRG RAM: expected $42, got $%X", got)
+	}
+
+	writeMMC1Register(nes, 0xE000, 0x10)
+	nes.Write(0x6000, 0x24)
+	if got := nes.Read(0x6000); got != 0x24 {
+		t.Errorf("disabled PRG RAM: expected the $24 left on the bus, got $%X", got)
+	}
+	writeMMC1Register(nes, 0xE000, 0x00)
+	if got := nes.Read(0x6000); got != 0x42 {
+		t.Errorf("disabled PRG RAM should ignore writes, got $%X", got)
+	}
+}
@@ -0,0 +1,71 @@
+package nes
+
+//UxROM
+//https://wiki.nesdev.com/w/index.php/UxROM
+type Mapper2 struct {
+	nes *NES
+	hasBusConflicts bool
+
+	prgBank int
+}
+
+func MakeNewMapper2(nes *NES, hasBusConflicts bool) *Mapper2 {
+	return &Mapper2{nes: nes, hasBusConflicts: hasBusConflicts}
+}
+
+func (mapper *Mapper2) setBusConflicts(enabled bool) {
+	mapper.hasBusConflicts = enabled
+}
+
+func (mapper *Mapper2) Read(addr uint16) byte {
+	cart := mapper.nes.cart
+
+	switch {
+	case addr < 0x2000:
+		return cart.chr[addr]
+	case addr >= 0x6000 && addr < 0x8000:
+		return cart.readWram(addr-0x6000, mapper.nes.openBus)
+	case addr >= 0xC000: //fixed to the last bank
+		offset := len(cart.prg) - 0x4000 + int(addr-0xC000)
+		return cart.prg[offset%len(cart.prg)]
+	case addr >= 0x8000:
+		offset := mapper.prgBank*0x4000 + int(addr-0x8000)
+		return cart.prg[offset%len(cart.prg)]
+	default:
+		mapper.nes.diagnose(addr, "mapper read outside the cartridge")
+	}
+
+	return mapper.nes.openBus
+}
+
+func (mapper *Mapper2) Write(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		mapper.nes.cart.writeChr(int(addr), value)
+	case addr >= 0x6000 && addr < 0x8000:
+		mapper.nes.cart.writeWram(addr-0x6000, value)
+	case addr >= 0x8000:
+		if mapper.hasBusConflicts {
+			value = applyBusConflict(mapper, addr, value)
+		}
+		mapper.prgBank = int(value)
+	default:
+		mapper.nes.diagnose(addr, "mapper write of $%02X outside the cartridge", value)
+	}
+}
+
+func (mapper *Mapper2) Mirroring() byte {
+	return mapper.nes.cart.getNametableMirroring()
+}
+
+func (mapper *Mapper2) NametablePage(table byte) []byte {
+	return mirroredNametablePage(mapper.nes, mapper.Mirroring(), table)
+}
+
+func (mapper *Mapper2) saveState(s *stateWriter) {
+	s.writeInt(mapper.prgBank)
+}
+
+func (mapper *Mapper2) loadState(s *stateReader) {
+	s.readInt(&mapper.prgBank)
+}
@@ -0,0 +1,60 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMapper2BankSwitching(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(2, 8, 1), WithBusConflicts(false))
+
+	nes.Write(0x8000, 5)
+	if got := nes.Read(0x8000); got != 5 {
+		t.Errorf("$8000: expected bank 5, got %v", got)
+	}
+	if got := nes.Read(0xC000); got != 7 {
+		t.Errorf("$C000: expected last bank 7, got %v", got)
+	}
+}
+
+func TestMapper2BusConflicts(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(2, 8, 1), WithBusConflicts(true))
+
+	//ROM at $C000 holds 7, so the full value gets through
+	nes.Write(0xC000, 3)
+	if got := nes.Read(0x8000); got != 3 {
+		t.Errorf("expected bank 3, got %v", got)
+	}
+
+	//ROM at $8000 now holds 3, 5&3 selects bank 1
+	nes.Write(0x8000, 5)
+	if got := nes.Read(0x8000); got != 1 {
+		t.Errorf("expected bus conflict to select bank 1, got %v", got)
+	}
+}
+
+func TestMapper2BusConflictOverride(t *testing.T) {
+	//NES 2.0 submapper 2, bus conflicts by the header
+	header := [16]byte{'N', 'E', 'S', 0x1A, 8, 0, 0x20, 0x08, 0x20}
+	rom := append([]byte{}, header[:]...)
+	for bank := 0; bank < 8; bank++ {
+		rom = append(rom, bytes.Repeat([]byte{byte(bank)}, 0x4000)...)
+	}
+
+	for _, test := range []struct {
+		opts []Option
+		bank byte
+	}{
+		{nil, 0}, //5 ANDed with the 0 in ROM
+		{[]Option{WithBusConflicts(false)}, 5},
+	} {
+		nes, err := New(bytes.NewReader(rom), test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nes.WriteCPU(0x8000, 5) //over bank 0
+		if got := nes.ReadCPU(0x8000); got != test.bank {
+			t.Errorf("%v options: expected bank %v, got %v", len(test.opts), test.bank, got)
+		}
+	}
+}
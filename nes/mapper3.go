@@ -0,0 +1,68 @@
+package nes
+
+//CNROM
+//https://wiki.nesdev.com/w/index.php/INES_Mapper_003
+type Mapper3 struct {
+	nes *NES
+	hasBusConflicts bool
+
+	chrBank int
+}
+
+func MakeNewMapper3(nes *NES, hasBusConflicts bool) *Mapper3 {
+	return &Mapper3{nes: nes, hasBusConflicts: hasBusConflicts}
+}
+
+func (mapper *Mapper3) setBusConflicts(enabled bool) {
+	mapper.hasBusConflicts = enabled
+}
+
+func (mapper *Mapper3) Read(addr uint16) byte {
+	cart := mapper.nes.cart
+
+	switch {
+	case addr < 0x2000:
+		offset := mapper.chrBank*0x2000 + int(addr)
+		return cart.chr[offset%len(cart.chr)]
+	case addr >= 0x6000 && addr < 0x8000:
+		return cart.readWram(addr-0x6000, mapper.nes.openBus)
+	case addr >= 0x8000: //16K PRG is mirrored like NROM-128
+		return cart.prg[int(addr-0x8000)%len(cart.prg)]
+	default:
+		mapper.nes.diagnose(addr, "mapper read outside the cartridge")
+	}
+
+	return mapper.nes.openBus
+}
+
+func (mapper *Mapper3) Write(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		mapper.nes.cart.writeChr(mapper.chrBank*0x2000 + int(addr), value)
+	case addr >= 0x6000 && addr < 0x8000:
+		mapper.nes.cart.writeWram(addr-0x6000, value)
+	case addr >= 0x8000:
+		if mapper.hasBusConflicts {
+			value = applyBusConflict(mapper, addr, value)
+		}
+		mapper.chrBank = int(value)
+	default:
+		mapper.nes.diagnose(addr, "mapper write of $%02X outside the cartridge", value)
+	}
+}
+
+func (mapper *Mapper3) Mirroring() byte {
+	return mapper.nes.cart.getNametableMirroring()
+}
+
+func (mapper *Mapper3) NametablePage(table byte) []byte {
+	return mirroredNametablePage(mapper.nes, mapper.Mirroring(), table)
+}
+
+func (mapper *Mapper3) saveState(s *stateWriter) {
+	s.writeInt(mapper.chrBank)
+}
+
+func (mapper *Mapper3) loadState(s *stateReader) {
+	s.readInt(&mapper.chrBank)
+}
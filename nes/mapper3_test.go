@@ -0,0 +1,20 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestMapper3ChrBankSwitching(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(3, 1, 4), WithBusConflicts(false))
+
+	nes.Write(0x8000, 2)
+	if got := nes.ppu.Read(0x0000); got != 4 {
+		t.Errorf("$0000: expected 4K bank 4, got %v", got)
+	}
+	if got := nes.ppu.Read(0x1FFF); got != 5 {
+		t.Errorf("$1FFF: expected 4K bank 5, got %v", got)
+	}
+	if got := nes.Read(0xC000); got != 0 {
+		t.Errorf("16K PRG should be mirrored at $C000, got bank %v", got)
+	}
+}
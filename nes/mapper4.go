@@ -0,0 +1,188 @@
+package nes
+
+//MMC3
+//https://wiki.nesdev.com/w/index.php/MMC3
+type Mapper4 struct {
+	nes *NES
+
+	bankSelect byte
+	registers  [8]byte
+	mirroring  byte
+	prgRamProtect byte
+
+	irqLatch   byte
+	irqCounter byte
+	irqReload  bool
+	irqEnabled bool
+
+	a12     bool
+	a12LowSince uint64
+
+	prgOffsets [4]int //8K windows at $8000, $A000, $C000, $E000
+	chrOffsets [8]int //1K windows from $0000 to $1C00
+}
+
+//A12 must stay low this many PPU cycles before a rising edge clocks the counter
+const mapper4A12Filter = 8
+
+func MakeNewMapper4(nes *NES) *Mapper4 {
+	mapper := Mapper4{nes: nes}
+	mapper.mirroring = nes.cart.getMirroringId()
+	mapper.prgRamProtect = 0x80
+	mapper.updateOffsets()
+	return &mapper
+}
+
+func (mapper *Mapper4) Read(addr uint16) byte {
+	cart := mapper.nes.cart
+
+	switch {
+	case addr < 0x2000:
+		offset := mapper.chrOffsets[addr/0x0400] + int(addr%0x0400)
+		return cart.chr[offset%len(cart.chr)]
+	case addr >= 0x6000 && addr < 0x8000:
+		if !mapper.isPrgRamEnabled() {
+			mapper.nes.diagnose(addr, "read from disabled PRG RAM")
+			return mapper.nes.openBus
+		}
+		return cart.readWram(addr-0x6000, mapper.nes.openBus)
+	case addr >= 0x8000:
+		offset := mapper.prgOffsets[(addr-0x8000)/0x2000] + int(addr%0x2000)
+		return cart.prg[offset%len(cart.prg)]
+	default:
+		mapper.nes.diagnose(addr, "mapper read outside the cartridge")
+	}
+
+	return mapper.nes.openBus
+}
+
+func (mapper *Mapper4) Write(addr uint16, value byte) {
+	isEven := addr%2 == 0
+
+	switch {
+	case addr < 0x2000:
+		mapper.nes.cart.writeChr(mapper.chrOffsets[addr/0x0400] + int(addr%0x0400), value)
+	case addr >= 0x6000 && addr < 0x8000:
+		if mapper.isPrgRamEnabled() && !mapper.isPrgRamWriteProtected() {
+			mapper.nes.cart.writeWram(addr-0x6000, value)
+		}
+	case addr < 0xA000 && isEven:
+		mapper.bankSelect = value
+		mapper.updateOffsets()
+	case addr < 0xA000:
+		mapper.registers[mapper.bankSelect&7] = value
+		mapper.updateOffsets()
+	case addr < 0xC000 && isEven:
+		if value&1 == 0 {
+			mapper.mirroring = mirrorVertical
+		} else {
+			mapper.mirroring = mirrorHorizontal
+		}
+	case addr < 0xC000:
+		mapper.prgRamProtect = value
+	case addr < 0xE000 && isEven:
+		mapper.irqLatch = value
+	case addr < 0xE000:
+		mapper.irqCounter = 0
+		mapper.irqReload = true
+	case isEven:
+		mapper.irqEnabled = false
+		mapper.nes.cpu.acknowledgeIRQ(irqSourceMapper)
+	default:
+		mapper.irqEnabled = true
+	}
+}
+
+func (mapper *Mapper4) updateOffsets() {
+	prgBanks := len(mapper.nes.cart.prg) / 0x2000
+	secondLast := (prgBanks - 2) * 0x2000
+	r6 := int(mapper.registers[6]&0x3F) * 0x2000
+	r7 := int(mapper.registers[7]&0x3F) * 0x2000
+
+	if (mapper.bankSelect>>6)&1 == 0 {
+		mapper.prgOffsets[0] = r6
+		mapper.prgOffsets[2] = secondLast
+	} else {
+		mapper.prgOffsets[0] = secondLast
+		mapper.prgOffsets[2] = r6
+	}
+	mapper.prgOffsets[1] = r7
+	mapper.prgOffsets[3] = (prgBanks - 1) * 0x2000
+
+	//Two 2K banks and four 1K banks, swapped between halves by the A12 inversion bit
+	var banks [8]int
+	banks[0] = int(mapper.registers[0] & 0xFE)
+	banks[1] = int(mapper.registers[0] | 0x01)
+	banks[2] = int(mapper.registers[1] & 0xFE)
+	banks[3] = int(mapper.registers[1] | 0x01)
+	for i := 0; i < 4; i++ {
+		banks[4+i] = int(mapper.registers[2+i])
+	}
+
+	inversion := 0
+	if (mapper.bankSelect>>7)&1 == 1 {
+		inversion = 4
+	}
+	for i := 0; i < 8; i++ {
+		mapper.chrOffsets[i^inversion] = banks[i] * 0x0400
+	}
+}
+
+func (mapper *Mapper4) isPrgRamEnabled() bool {
+	return (mapper.prgRamProtect>>7)&1 == 1
+}
+
+func (mapper *Mapper4) isPrgRamWriteProtected() bool {
+	return (mapper.prgRamProtect>>6)&1 == 1
+}
+
+func (mapper *Mapper4) Mirroring() byte {
+	if mapper.nes.cart.getNametableMirroring() == mirrorFourScreen {
+		return mirrorFourScreen
+	}
+	return mapper.mirroring
+}
+
+//The scanline counter is clocked by filtered rising edges of PPU A12
+func (mapper *Mapper4) ObservePPUAddress(addr uint16) {
+	a12 := addr&0x1000 != 0
+	now := mapper.nes.ppu.totalCycles
+
+	if a12 && !mapper.a12 && now-mapper.a12LowSince >= mapper4A12Filter {
+		mapper.clockScanlineCounter()
+	}
+	if !a12 && mapper.a12 {
+		mapper.a12LowSince = now
+	}
+	mapper.a12 = a12
+}
+
+func (mapper *Mapper4) clockScanlineCounter() {
+	if mapper.irqCounter == 0 || mapper.irqReload {
+		mapper.irqCounter = mapper.irqLatch
+		mapper.irqReload = false
+	} else {
+		mapper.irqCounter--
+	}
+
+	if mapper.irqCounter == 0 && mapper.irqEnabled {
+		mapper.nes.cpu.assertIRQ(irqSourceMapper)
+	}
+}
+
+func (mapper *Mapper4) NametablePage(table byte) []byte {
+	return mirroredNametablePage(mapper.nes, mapper.Mirroring(), table)
+}
+
+func (mapper *Mapper4) saveState(s *stateWriter) {
+	s.write(mapper.bankSelect, mapper.registers, mapper.mirroring, mapper.prgRamProtect,
+		mapper.irqLatch, mapper.irqCounter, mapper.irqReload, mapper.irqEnabled,
+		mapper.a12, mapper.a12LowSince)
+}
+
+func (mapper *Mapper4) loadState(s *stateReader) {
+	s.read(&mapper.bankSelect, &mapper.registers, &mapper.mirroring, &mapper.prgRamProtect,
+		&mapper.irqLatch, &mapper.irqCounter, &mapper.irqReload, &mapper.irqEnabled,
+		&mapper.a12, &mapper.a12LowSince)
+	mapper.updateOffsets()
+}
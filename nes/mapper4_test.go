@@ -0,0 +1,144 @@
+package nes
+
+import (
+	"testing"
+)
+
+//Numbers every 8K PRG bank and 1K CHR bank
+func makeTestMapper4NES() *NES {
+	cart := makeTestCartridge(4, 8, 8)
+	for i := range cart.prg {
+		cart.prg[i] = byte(i / 0x2000)
+	}
+	for i := range cart.chr {
+		cart.chr[i] = byte(i / 0x0400)
+	}
+	return makeTestNES(cart)
+}
+
+func TestMapper4PrgBankModes(t *testing.T) {
+	nes := makeTestMapper4NES()
+	nes.Write(0x8000, 6)
+	nes.Write(0x8001, 3)
+	nes.Write(0x8000, 7)
+	nes.Write(0x8001, 4)
+
+	expected := []byte{3, 4, 14, 15}
+	for i, bank := range expected {
+		if got := nes.Read(0x8000 + uint16(i)*0x2000); got != bank {
+			t.Errorf("mode 0 window %v: expected bank %v, got %v", i, bank, got)
+		}
+	}
+
+	nes.Write(0x8000, 0x40)
+	expected = []byte{14, 4, 3, 15}
+	for i, bank := range expected {
+		if got := nes.Read(0x8000 + uint16(i)*0x2000); got != bank {
+			t.Errorf("mode 1 window %v: expected bank %v, got %v", i, bank, got)
+		}
+	}
+}
+
+func TestMapper4ChrBankInversion(t *testing.T) {
+	nes := makeTestMapper4NES()
+	values := []byte{8, 10, 1, 2, 3, 4}
+	for i, value := range values {
+		nes.Write(0x8000, byte(i))
+		nes.Write(0x8001, value)
+	}
+
+	expected := []byte{8, 9, 10, 11, 1, 2, 3, 4}
+	for i, bank := range expected {
+		if got := nes.ppu.Read(uint16(i) * 0x400); got != bank {
+			t.Errorf("window %v: expected bank %v, got %v", i, bank, got)
+		}
+	}
+
+	nes.Write(0x8000, 0x80)
+	expected = []byte{1, 2, 3, 4, 8, 9, 10, 11}
+	for i, bank := range expected {
+		if got := nes.ppu.Read(uint16(i) * 0x400); got != bank {
+			t.Errorf("inverted window %v: expected bank %v, got %v", i, bank, got)
+		}
+	}
+}
+
+func TestMapper4Mirroring(t *testing.T) {
+	nes := makeTestMapper4NES()
+	nes.Write(0xA000, 0)
+	if got := nes.mapper.(*Mapper4).Mirroring(); got != mirrorVertical {
+		t.Errorf("expected vertical mirroring, got %v", got)
+	}
+	nes.Write(0xA000, 1)
+	if got := nes.mapper.(*Mapper4).Mirroring(); got != mirrorHorizontal {
+		t.Errorf("expected horizontal mirroring, got %v", got)
+	}
+}
+
+func TestMapper4PrgRamProtect(t *testing.T) {
+	nes := makeTestMapper4NES()
+	nes.Write(0x6000, 0x42)
+
+	nes.Write(0xA001, 0xC0)
+	nes.Write(0x6000, 0x24)
+	if got := nes.Read(0x6000); got != 0x42 {
+		t.Errorf("write protected PRG RAM: expected $42, got $%X", got)
+	}
+
+	nes.Write(0xA001, 0x00)
+	if got := nes.Read(0x6000); got != 0x00 {
+		t.Errorf("disabled PRG RAM: expected the $00 left on the bus, got $%X", got)
+	}
+}
+
+func TestMapper4ScanlineIRQ(t *testing.T) {
+	nes := makeTestMapper4NES()
+	nes.Write(0xC000, 10)
+	nes.Write(0xC001, 0)
+	nes.Write(0xE001, 0)
+
+	//Background at $0000, sprites at $1000 gives one A12 rise per scanline
+	nes.ppu.WriteCtrl(0x08)
+	nes.ppu.WriteMask(0x18)
+	nes.ppu.scanline = 0
+	nes.ppu.cycles = 0
+	for nes.cpu.irqLine == 0 && nes.ppu.scanline < 240 {
+		nes.ppu.Run()
+	}
+
+	if nes.cpu.irqLine&irqSourceMapper == 0 {
+		t.Fatalf("IRQ was never asserted")
+	}
+	if nes.ppu.scanline != 10 {
+		t.Errorf("expected IRQ on scanline 10, got %v", nes.ppu.scanline)
+	}
+
+	nes.Write(0xE000, 0)
+	if nes.cpu.irqLine != 0 {
+		t.Errorf("$E000 write should acknowledge the IRQ")
+	}
+}
+
+func TestMapper4A12Filter(t *testing.T) {
+	nes := makeTestMapper4NES()
+	nes.Write(0xC000, 1)
+	nes.Write(0xE001, 0)
+	nes.ppu.totalCycles = 100
+
+	//Rapid toggling, e.g. 8x16 sprites from both tables, clocks only once
+	for i := 0; i < 4; i++ {
+		nes.ppu.Read(0x0000)
+		nes.ppu.Read(0x1000)
+		nes.ppu.totalCycles++
+	}
+	if nes.cpu.irqLine != 0 {
+		t.Errorf("filtered edges should not reach the counter")
+	}
+
+	nes.ppu.Read(0x0000)
+	nes.ppu.totalCycles += mapper4A12Filter
+	nes.ppu.Read(0x1000)
+	if nes.cpu.irqLine&irqSourceMapper == 0 {
+		t.Errorf("expected IRQ after second filtered rise")
+	}
+}
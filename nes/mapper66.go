@@ -0,0 +1,72 @@
+package nes
+
+//GxROM
+//https://wiki.nesdev.com/w/index.php/GxROM
+type Mapper66 struct {
+	nes *NES
+	hasBusConflicts bool
+
+	prgBank int
+	chrBank int
+}
+
+func MakeNewMapper66(nes *NES, hasBusConflicts bool) *Mapper66 {
+	return &Mapper66{nes: nes, hasBusConflicts: hasBusConflicts}
+}
+
+func (mapper *Mapper66) setBusConflicts(enabled bool) {
+	mapper.hasBusConflicts = enabled
+}
+
+func (mapper *Mapper66) Read(addr uint16) byte {
+	cart := mapper.nes.cart
+
+	switch {
+	case addr < 0x2000:
+		offset := mapper.chrBank*0x2000 + int(addr)
+		return cart.chr[offset%len(cart.chr)]
+	case addr >= 0x6000 && addr < 0x8000:
+		return cart.readWram(addr-0x6000, mapper.nes.openBus)
+	case addr >= 0x8000:
+		offset := mapper.prgBank*0x8000 + int(addr-0x8000)
+		return cart.prg[offset%len(cart.prg)]
+	default:
+		mapper.nes.diagnose(addr, "mapper read outside the cartridge")
+	}
+
+	return mapper.nes.openBus
+}
+
+func (mapper *Mapper66) Write(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		mapper.nes.cart.writeChr(mapper.chrBank*0x2000 + int(addr), value)
+	case addr >= 0x6000 && addr < 0x8000:
+		mapper.nes.cart.writeWram(addr-0x6000, value)
+	case addr >= 0x8000:
+		if mapper.hasBusConflicts {
+			value = applyBusConflict(mapper, addr, value)
+		}
+		//--PP--CC
+		mapper.prgBank = int((value >> 4) & 0x03)
+		mapper.chrBank = int(value & 0x03)
+	default:
+		mapper.nes.diagnose(addr, "mapper write of $%02X outside the cartridge", value)
+	}
+}
+
+func (mapper *Mapper66) Mirroring() byte {
+	return mapper.nes.cart.getNametableMirroring()
+}
+
+func (mapper *Mapper66) NametablePage(table byte) []byte {
+	return mirroredNametablePage(mapper.nes, mapper.Mirroring(), table)
+}
+
+func (mapper *Mapper66) saveState(s *stateWriter) {
+	s.writeInt(mapper.prgBank, mapper.chrBank)
+}
+
+func (mapper *Mapper66) loadState(s *stateReader) {
+	s.readInt(&mapper.prgBank, &mapper.chrBank)
+}
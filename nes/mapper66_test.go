@@ -0,0 +1,17 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestMapper66BankSwitching(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(66, 8, 4), WithBusConflicts(false))
+
+	nes.Write(0x8000, 0x21)
+	if got := nes.Read(0x8000); got != 4 {
+		t.Errorf("$8000: expected 16K bank 4, got %v", got)
+	}
+	if got := nes.ppu.Read(0x1000); got != 3 {
+		t.Errorf("$1000: expected 4K bank 3, got %v", got)
+	}
+}
@@ -0,0 +1,80 @@
+package nes
+
+//AxROM
+//https://wiki.nesdev.com/w/index.php/AxROM
+type Mapper7 struct {
+	nes *NES
+	hasBusConflicts bool
+
+	prgBank   int
+	mirroring byte
+}
+
+func MakeNewMapper7(nes *NES, hasBusConflicts bool) *Mapper7 {
+	return &Mapper7{
+		nes: nes,
+		hasBusConflicts: hasBusConflicts,
+		mirroring: mirrorSingleScreenLow,
+	}
+}
+
+func (mapper *Mapper7) setBusConflicts(enabled bool) {
+	mapper.hasBusConflicts = enabled
+}
+
+func (mapper *Mapper7) Read(addr uint16) byte {
+	cart := mapper.nes.cart
+
+	switch {
+	case addr < 0x2000:
+		return cart.chr[addr]
+	case addr >= 0x6000 && addr < 0x8000:
+		return cart.readWram(addr-0x6000, mapper.nes.openBus)
+	case addr >= 0x8000:
+		offset := mapper.prgBank*0x8000 + int(addr-0x8000)
+		return cart.prg[offset%len(cart.prg)]
+	default:
+		mapper.nes.diagnose(addr, "mapper read outside the cartridge")
+	}
+
+	return mapper.nes.openBus
+}
+
+func (mapper *Mapper7) Write(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		mapper.nes.cart.writeChr(int(addr), value)
+	case addr >= 0x6000 && addr < 0x8000:
+		mapper.nes.cart.writeWram(addr-0x6000, value)
+	case addr >= 0x8000:
+		if mapper.hasBusConflicts {
+			value = applyBusConflict(mapper, addr, value)
+		}
+		mapper.prgBank = int(value & 0x07)
+		if value&0x10 == 0 {
+			mapper.mirroring = mirrorSingleScreenLow
+		} else {
+			mapper.mirroring = mirrorSingleScreenHigh
+		}
+	default:
+		mapper.nes.diagnose(addr, "mapper write of $%02X outside the cartridge", value)
+	}
+}
+
+func (mapper *Mapper7) Mirroring() byte {
+	return mapper.mirroring
+}
+
+func (mapper *Mapper7) NametablePage(table byte) []byte {
+	return mirroredNametablePage(mapper.nes, mapper.Mirroring(), table)
+}
+
+func (mapper *Mapper7) saveState(s *stateWriter) {
+	s.write(mapper.mirroring)
+	s.writeInt(mapper.prgBank)
+}
+
+func (mapper *Mapper7) loadState(s *stateReader) {
+	s.read(&mapper.mirroring)
+	s.readInt(&mapper.prgBank)
+}
@@ -0,0 +1,25 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestMapper7BankAndMirroring(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(7, 8, 1))
+
+	nes.Write(0x8000, 0x12)
+	if got := nes.Read(0x8000); got != 4 {
+		t.Errorf("$8000: expected 16K bank 4, got %v", got)
+	}
+	if got := nes.Read(0xC000); got != 5 {
+		t.Errorf("$C000: expected 16K bank 5, got %v", got)
+	}
+	if got := nes.mapper.(*Mapper7).Mirroring(); got != mirrorSingleScreenHigh {
+		t.Errorf("expected single screen high, got %v", got)
+	}
+
+	nes.Write(0x8000, 0x00)
+	if got := nes.mapper.(*Mapper7).Mirroring(); got != mirrorSingleScreenLow {
+		t.Errorf("expected single screen low, got %v", got)
+	}
+}
@@ -0,0 +1,159 @@
+package nes
+
+import (
+	"fmt"
+)
+
+type Memory interface {
+	Read(addr uint16) byte
+	Write(addr uint16, value byte)
+}
+
+//An access real hardware tolerates but that usually points at an emulator
+//or game bug, e.g. reading a write-only register
+type Diagnostic struct {
+	Addr    uint16
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("$%04X: %v", d.Addr, d.Message)
+}
+
+//hook is called for every Diagnostic, nil turns them off
+func (nes *NES) SetDiagnosticHook(hook func(d Diagnostic)) {
+	nes.diagnosticHook = hook
+}
+
+func (nes *NES) diagnose(addr uint16, format string, args ...interface{}) {
+	if nes.diagnosticHook != nil {
+		nes.diagnosticHook(Diagnostic{Addr: addr, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (cpu *Cpu) ReadUint16(addr uint16) uint16 {
+	return uint16(cpu.read(addr)) | uint16(uint16(cpu.read(addr+1))<<8)
+}
+
+//cpu memory map
+//Unmapped reads return open bus, the last value the CPU saw on the data bus
+//https://wiki.nesdev.com/w/index.php/Open_bus_behavior
+func (nes *NES) Read(addr uint16) byte {
+	nes.openBus = nes.read(addr)
+	return nes.openBus
+}
+
+func (nes *NES) read(addr uint16) byte {
+	switch {
+	case addr < 0x2000:
+		return nes.ram[addr%0x0800]
+	case addr < 0x4000:
+		a := addr%8 + 0x2000
+		return nes.ppu.ReadRegisters(a)
+	case addr == 0x4015:
+		return nes.apu.ReadStatus()
+	//Port devices only drive the low bits, the rest is usually $40 left over from the address
+	case addr == 0x4016:
+		return nes.openBus&0xE0 | nes.readPort(Port1)
+	case addr == 0x4017:
+		return nes.openBus&0xE0 | nes.readPort(Port2)
+	case addr <= 0x4014:
+		nes.diagnose(addr, "read from write-only APU register")
+		return nes.openBus
+	case addr < 0x6000:
+		nes.diagnose(addr, "open bus read")
+		return nes.openBus
+	default: //PRG RAM and ROM are banked by the mapper
+		return nes.mapper.Read(addr)
+	}
+}
+
+func (nes *NES) Write(addr uint16, content byte) {
+	nes.openBus = content
+	switch {
+	case addr < 0x2000:
+		nes.ram[addr % 0x0800] = content
+	case addr < 0x4000:
+		a := addr%8 + 0x2000
+		nes.ppu.WriteRegisters(a, content)
+	case addr == 0x4014:
+		nes.ppu.lastRegisterWrite = content
+		nes.ppu.WriteOamDma(content)
+	case addr < 0x4014 || addr == 0x4015:
+		nes.apu.WriteRegister(addr, content)
+	case addr == 0x4016:
+		nes.strobePorts(content)
+	case addr == 0x4017: //frame counter, reads are joy stick 2
+		nes.apu.WriteRegister(addr, content)
+	case addr < 0x6000:
+		nes.diagnose(addr, "write of $%02X to unmapped address", content)
+	default:
+		nes.mapper.Write(addr, content)
+	}
+}
+
+//ppu memory map
+//https://wiki.nesdev.com/w/index.php/PPU_memory_map
+func (ppu *PPU) Read(addr uint16) byte {
+	addr %= 0x4000
+	switch {
+	case addr < 0x2000:
+		if ppu.addressObserver != nil {
+			ppu.addressObserver.ObservePPUAddress(addr)
+		}
+		return ppu.nes.mapper.Read(addr)
+	case addr < 0x3F00: //Maps from $2000-$3EFF
+
+		if addr >= 0x3000 {
+			addr -= 0x1000
+		}
+		
+		page := ppu.nes.mapper.NametablePage(byte((addr-0x2000)/0x400))
+		return page[addr%0x400]
+	default:
+		return ppu.ReadPalette(addr%32)
+	}
+}
+
+func (ppu *PPU) Write(addr uint16, value byte) {
+	addr %= 0x4000
+	switch {
+	case addr < 0x2000:
+		if ppu.addressObserver != nil {
+			ppu.addressObserver.ObservePPUAddress(addr)
+		}
+		ppu.nes.mapper.Write(addr, value)
+	case addr < 0x3F00: //Maps from $2000-$3EFF
+		if addr >= 0x3000 {
+			addr -= 0x1000
+		}
+		
+		page := ppu.nes.mapper.NametablePage(byte((addr-0x2000)/0x400))
+		page[addr%0x400] = value
+	default:
+		ppu.WritePalette(addr%32, value)
+	}
+}
+
+//Maps nametable 0-3 onto the 2K of CIRAM in the console,
+//four-screen boards supply the upper two from cartridge RAM
+func mirroredNametablePage(nes *NES, mirroring byte, table byte) []byte {
+	var page byte
+	switch mirroring {
+	case mirrorHorizontal:
+		page = table/2
+	case mirrorVertical:
+		page = table%2
+	case mirrorSingleScreenLow:
+		page = 0
+	case mirrorSingleScreenHigh:
+		page = 1
+	case mirrorFourScreen:
+		if table >= 2 {
+			return nes.cart.vram[uint16(table-2)*0x400:uint16(table-1)*0x400]
+		}
+		page = table
+	}
+
+	return nes.ppu.vram[uint16(page)*0x400:uint16(page+1)*0x400]
+}
@@ -0,0 +1,92 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestNametableMirroring(t *testing.T) {
+	tests := []struct {
+		name  string
+		flag6 byte
+		pages [4]int //physical page behind $2000, $2400, $2800 and $2C00
+	}{
+		{"horizontal", 0x00, [4]int{0, 0, 1, 1}},
+		{"vertical", 0x01, [4]int{0, 1, 0, 1}},
+		{"four-screen", 0x08, [4]int{0, 1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		cart := makeTestCartridge(0, 1, 1)
+		cart.header.Flag6 |= test.flag6
+		nes := makeTestNES(cart)
+
+		for i := 0; i < 4; i++ {
+			for j := 0; j < 4; j++ {
+				nes.ppu.Write(0x2000+uint16(j)*0x400+5, 0)
+			}
+			nes.ppu.Write(0x2000+uint16(i)*0x400+5, 0xAB)
+
+			for j := 0; j < 4; j++ {
+				isAliased := nes.ppu.Read(0x2000+uint16(j)*0x400+5) == 0xAB
+				if isAliased != (test.pages[i] == test.pages[j]) {
+					t.Errorf("%v: nametable %v aliasing nametable %v is %v", test.name, j, i, isAliased)
+				}
+			}
+		}
+	}
+}
+
+func TestChrRamWritesThroughPPUData(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(2, 2, 0))
+
+	nes.Read(0x2002) //reset the address latch
+	nes.Write(0x2006, 0x12)
+	nes.Write(0x2006, 0x34)
+	nes.Write(0x2007, 0x5A)
+
+	if got := nes.ppu.Read(0x1234); got != 0x5A {
+		t.Errorf("expected $5A in CHR RAM at $1234, got $%X", got)
+	}
+}
+
+func TestChrRomIgnoresWrites(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 1, 1))
+
+	nes.ppu.Write(0x1234, 0x5A)
+	if got := nes.ppu.Read(0x1234); got != 1 {
+		t.Errorf("CHR ROM should be read-only, got $%X", got)
+	}
+}
+
+func TestOpenBusAndDiagnostics(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 1, 1))
+	var diagnostics []Diagnostic
+	nes.SetDiagnosticHook(func(d Diagnostic) {
+		diagnostics = append(diagnostics, d)
+	})
+
+	nes.Write(0x0000, 0x5A)
+	nes.Read(0x0000)
+	if got := nes.Read(0x5000); got != 0x5A {
+		t.Errorf("unmapped read should return the last bus value $5A, got $%02X", got)
+	}
+	if got := nes.Read(0x4000); got != 0x5A {
+		t.Errorf("write-only APU register should read open bus, got $%02X", got)
+	}
+	nes.Write(0x2001, 0x1E)
+	if got := nes.Read(0x2000); got != 0x1E {
+		t.Errorf("write-only PPU register should read the PPU latch $1E, got $%02X", got)
+	}
+	nes.Write(0x2002, 0x00)
+	nes.Write(0x4020, 0x00)
+
+	want := []uint16{0x5000, 0x4000, 0x2000, 0x2002, 0x4020}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("expected %v diagnostics, got %v", len(want), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d.Addr != want[i] {
+			t.Errorf("diagnostic %v: expected $%04X, got %v", i, want[i], d)
+		}
+	}
+}
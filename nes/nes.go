@@ -0,0 +1,246 @@
+//Package nes emulates the NES console: CPU, PPU, APU, controllers and cartridge mappers.
+//Front ends load a rom with New and drive it one frame at a time.
+package nes
+
+
+import(
+	"fmt"
+	"image"
+	"io"
+)
+
+type NES struct {
+	cpu *Cpu
+	ram [0xFFFF+1]byte
+	ppu *PPU
+	apu *APU
+	controllers [4]*GameController //built in, 0 and 1 start out in the ports
+	zappers [2]*Zapper
+	fourScore *FourScore
+	ports [3]PortDevice //$4016, $4017 and the expansion port
+	mapper Mapper
+	cart *Cartridge
+
+	syncedCycles uint64 //CPU cycle the PPU and APU have been run up to
+	hasPALClock bool //16 PPU dots every 5 CPU cycles instead of 3 per cycle
+	openBus byte //last value on the CPU data bus
+	diagnosticHook func(d Diagnostic)
+}
+
+//Configures a console created by New
+type Option func(nes *NES)
+
+//Also see SetFrameSink
+func WithFrameSink(sink FrameSink) Option {
+	return func(nes *NES) {
+		nes.SetFrameSink(sink)
+	}
+}
+
+//Also see SetDiagnosticHook
+func WithDiagnosticHook(hook func(d Diagnostic)) Option {
+	return func(nes *NES) {
+		nes.SetDiagnosticHook(hook)
+	}
+}
+
+//Also see SetBusConflicts
+func WithBusConflicts(enabled bool) Option {
+	return func(nes *NES) {
+		nes.SetBusConflicts(enabled)
+	}
+}
+
+//Loads an iNES or NES 2.0 rom and powers the console on. Fails with
+//ErrBadMagic, ErrTruncatedRom, ErrRomTooLarge or ErrUnsupportedMapper.
+func New(rom io.Reader, opts ...Option) (*NES, error) {
+	cart, err := ReadRom(rom)
+	if err != nil {
+		return nil, err
+	}
+	nes, err := MakeNewNES(&cart)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(nes)
+	}
+	return nes, nil
+}
+
+func MakeNewNES(cartridge *Cartridge) (*NES, error) {
+	nes := &NES{
+		cart: cartridge,		
+	}
+	var err error
+	nes.cart = cartridge
+	nes.hasPALClock = cartridge.getTimingMode() == timingPAL
+	nes.mapper, err = MakeNewMapper(nes)
+	if err != nil {
+		return nil, err
+	}
+	nes.ppu = MakeNewPPU(nes)
+	nes.cpu = MakeNewCpu(nes)
+	nes.apu = MakeNewAPU(nes)
+	nes.syncedCycles = nes.cpu.cycles
+	for i := range nes.controllers {
+		nes.controllers[i] = MakeNewGameController()
+	}
+	for port := range nes.zappers {
+		nes.zappers[port] = MakeNewZapper(nes.ppu)
+		nes.ports[port] = nes.controllers[port]
+	}
+	nes.fourScore = MakeNewFourScore(nes.controllers)
+
+	return nes, nil
+}
+
+//Completed frames go to sink, nil drops them
+func (nes *NES) SetFrameSink(sink FrameSink) {
+	nes.ppu.frameSink = sink
+}
+
+//Runs one CPU instruction and catches the APU and PPU up, returns the CPU cycles taken
+func (nes *NES) StepInstruction() int {
+	cycles := nes.cpu.run()
+	nes.catchUp(nes.cpu.cycles)
+	return cycles
+}
+
+//Runs the APU and PPU cycle by cycle until they reach CPU cycle cycles, the CPU
+//calls it before register accesses so they happen on the right PPU dot
+func (nes *NES) catchUp(cycles uint64) {
+	for nes.syncedCycles < cycles {
+		nes.syncedCycles++
+		nes.apu.Step()
+		nes.ppu.Run()
+		nes.ppu.Run()
+		nes.ppu.Run()
+		if nes.hasPALClock && nes.syncedCycles%5 == 0 {
+			nes.ppu.Run()
+		}
+	}
+}
+
+//https://wiki.nesdev.com/w/index.php/Cycle_reference_chart
+const (
+	ntscFrameRate = 60.0988
+	palFrameRate  = 50.007 //Dendy's faster clock over 312 lines lands on the same rate
+)
+
+//Frames per second of the console the rom was made for, multi-region roms run as NTSC
+func (nes *NES) FrameRate() float64 {
+	switch nes.cart.getTimingMode() {
+	case timingPAL, timingDendy:
+		return palFrameRate
+	}
+	return ntscFrameRate
+}
+
+//Runs until the PPU finishes the current frame
+func (nes *NES) StepFrame() {
+	frame := nes.ppu.frame
+	for nes.ppu.frame == frame {
+		nes.StepInstruction()
+	}
+	nes.latchPorts()
+}
+
+//The last completed frame, overwritten by the next StepFrame
+func (nes *NES) Frame() *image.RGBA {
+	return nes.ppu.frontBuffer
+}
+
+//Samples at SampleRate produced since the last call, in the range -1 to 1
+func (nes *NES) AudioSamples() []float32 {
+	return nes.apu.TakeSamples()
+}
+
+//Holds the buttons in mask down on controller 0 or 1, or 2 and 3 behind a multitap, see ButtonA
+func (nes *NES) SetButtons(port int, mask byte) {
+	if port >= 0 && port < len(nes.controllers) {
+		nes.controllers[port].setButtons(mask)
+	}
+}
+
+//Holds the buttons in mask down with autofire on controller 0-3, they toggle
+//every SetTurboRate frames while held
+func (nes *NES) SetTurboButtons(port int, mask byte) {
+	if port >= 0 && port < len(nes.controllers) {
+		nes.controllers[port].setTurboButtons(mask)
+	}
+}
+
+//Frames a turbo button stays down and then up, below 1 means DefaultTurboRate
+func (nes *NES) SetTurboRate(port int, frames int) {
+	if port >= 0 && port < len(nes.controllers) {
+		nes.controllers[port].setTurboRate(frames)
+	}
+}
+
+//Plays macro on controller 0-3 one mask per StepFrame, on top of the held
+//buttons, replacing a macro that is still playing
+func (nes *NES) PlayMacro(port int, macro Macro) {
+	if port >= 0 && port < len(nes.controllers) {
+		nes.controllers[port].playMacro(macro)
+	}
+}
+
+//Puts four controllers on the ports, MultitapNone goes back to controllers 0 and 1
+//in ports 1 and 2 and an empty expansion port
+func (nes *NES) ConnectMultitap(multitap Multitap) {
+	nes.ports[Port1] = nes.controllers[0]
+	nes.ports[Port2] = nes.controllers[1]
+	nes.ports[ExpansionPort] = nil
+
+	switch multitap {
+	case MultitapFourScore:
+		nes.ports[Port1] = fourScorePort{nes.fourScore, Port1}
+		nes.ports[Port2] = fourScorePort{nes.fourScore, Port2}
+	case MultitapFamicom:
+		nes.ports[ExpansionPort] = &famicomAdapter{[2]*GameController{nes.controllers[2], nes.controllers[3]}}
+	}
+}
+
+//Points the Zapper on port 0 or 1 at screen pixel x, y, off the screen aims away from the TV
+func (nes *NES) AimZapper(port int, x int, y int, trigger bool) {
+	if port >= 0 && port < len(nes.zappers) {
+		nes.zappers[port].Aim(x, y, trigger)
+	}
+}
+
+//CPU address space as a program sees it, including register side effects
+func (nes *NES) ReadCPU(addr uint16) byte {
+	return nes.Read(addr)
+}
+
+func (nes *NES) WriteCPU(addr uint16, value byte) {
+	nes.Write(addr, value)
+}
+
+//Returned by Halted, the CPU stopped on Opcode at PC
+type HaltError struct {
+	PC uint16
+	Opcode byte
+}
+
+func (e *HaltError) Error() string {
+	return fmt.Sprintf("CPU halted by opcode $%02X at $%04X", e.Opcode, e.PC)
+}
+
+//nil while the CPU runs, a *HaltError once it hit a STP opcode. A halted console
+//keeps producing frames and audio until Reset.
+func (nes *NES) Halted() error {
+	if !nes.cpu.halted {
+		return nil
+	}
+	return &HaltError{PC: nes.cpu.PC, Opcode: nes.cpu.haltOpcode}
+}
+
+//Presses the console's reset button, RAM and cartridge state survive
+//https://wiki.nesdev.com/w/index.php/CPU_power_up_state#After_reset
+func (nes *NES) Reset() {
+	nes.cpu.reset()
+	nes.ppu.Reset()
+	nes.apu.reset()
+}
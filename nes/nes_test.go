@@ -0,0 +1,266 @@
+package nes
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+)
+
+//Spins on JMP $8000
+func makeIdleCartridge() *Cartridge {
+	cart := makeTestCartridge(0, 2, 1)
+	copy(cart.prg, []byte{0x4C, 0x00, 0x80})
+	cart.prg[0x7FFC] = 0x00
+	cart.prg[0x7FFD] = 0x80
+	return cart
+}
+
+type countingFrameSink struct {
+	count int
+}
+
+func (sink *countingFrameSink) Present(frame *image.RGBA) {
+	sink.count++
+}
+
+func TestNewLoadsRom(t *testing.T) {
+	header := [16]byte{'N', 'E', 'S', 0x1A, 2, 1}
+	rom := append(header[:], make([]byte, 2*0x4000+0x2000)...)
+	rom[16+0x7FFC] = 0x34
+	rom[16+0x7FFD] = 0x92
+
+	sink := &countingFrameSink{}
+	nes, err := New(bytes.NewReader(rom), WithFrameSink(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nes.cpu.PC != 0x9234 {
+		t.Errorf("expected the reset vector $9234, got $%04X", nes.cpu.PC)
+	}
+	if nes.ppu.frameSink != sink {
+		t.Errorf("frame sink option not applied")
+	}
+}
+
+func TestStepFrame(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	sink := &countingFrameSink{}
+	nes.SetFrameSink(sink)
+
+	nes.ppu.paletteInfo[0] = 0x21
+	nes.WriteCPU(0x2001, 0x08) //background on, every pixel is the backdrop
+	for i := 0; i < 3; i++ {
+		nes.StepFrame()
+	}
+	if sink.count != 3 || nes.ppu.frame != 3 {
+		t.Errorf("expected 3 presented frames, got %v", sink.count)
+	}
+
+	frame := nes.Frame()
+	if frame.Bounds().Dx() != ScreenWidth || frame.Bounds().Dy() != ScreenHeight {
+		t.Errorf("unexpected frame size %v", frame.Bounds())
+	}
+	if got := frame.RGBAAt(100, 100); got.R != 0x3C || got.G != 0xBC || got.B != 0xFC || got.A != 0xFF {
+		t.Errorf("expected the backdrop color, got %v", got)
+	}
+	if samples := nes.AudioSamples(); len(samples) < 3*SampleRate/61 {
+		t.Errorf("expected three frames of audio, got %v samples", len(samples))
+	}
+}
+
+func TestSetButtons(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.SetButtons(0, ButtonA|ButtonStart|ButtonRight)
+
+	nes.WriteCPU(0x4016, 1)
+	nes.WriteCPU(0x4016, 0)
+	var got byte
+	for i := 0; i < 8; i++ {
+		got |= (nes.ReadCPU(0x4016) & 1) << i
+	}
+	if got != ButtonA|ButtonStart|ButtonRight {
+		t.Errorf("expected buttons $%02X, read $%02X", ButtonA|ButtonStart|ButtonRight, got)
+	}
+}
+
+func TestSecondController(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.SetButtons(0, ButtonB)
+	nes.SetButtons(1, ButtonA|ButtonDown)
+
+	//$4016 strobes both ports
+	nes.WriteCPU(0x4016, 1)
+	if nes.ReadCPU(0x4017)&1 != 1 || nes.ReadCPU(0x4016)&1 != 0 {
+		t.Errorf("strobed ports should report button A")
+	}
+	nes.WriteCPU(0x4016, 0)
+
+	//LDA $4017 sees $40 on the upper bits, left on the bus by the address byte
+	copy(nes.ram[:], []byte{0xAD, 0x17, 0x40})
+	nes.cpu.PC = 0x0000
+	nes.StepInstruction()
+	if nes.cpu.A != 0x41 {
+		t.Errorf("expected $41 from port 2, got $%02X", nes.cpu.A)
+	}
+
+	var got byte
+	for i := 1; i < 8; i++ {
+		got |= (nes.ReadCPU(0x4017) & 1) << i
+	}
+	if got|1 != ButtonA|ButtonDown {
+		t.Errorf("port 2: expected buttons $%02X, read $%02X", ButtonA|ButtonDown, got|1)
+	}
+}
+
+func TestReset(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.WriteCPU(0x0000, 0x42)
+	nes.WriteCPU(0x4015, 0x01)
+	nes.WriteCPU(0x4003, 0x18)
+	nes.cpu.PC = 0x1234
+	sp := nes.cpu.SP
+
+	nes.Reset()
+	if nes.cpu.PC != 0x8000 || nes.cpu.SP != sp-3 || nes.cpu.isFlagClear(IFlag) {
+		t.Errorf("unexpected cpu state after reset PC:$%04X SP:$%02X", nes.cpu.PC, nes.cpu.SP)
+	}
+	if nes.ReadCPU(0x0000) != 0x42 {
+		t.Errorf("reset should keep RAM")
+	}
+	if nes.apu.pulse1.lengthCounter != 0 {
+		t.Errorf("reset should silence the APU")
+	}
+}
+
+//Pacing at FrameRate has to run the CPU at the clock the APU samples with
+func TestFrameRate(t *testing.T) {
+	tests := []struct {
+		name         string
+		flag7        byte
+		flag9        byte
+		flag12       byte
+		frameRate    float64
+		cpuFrequency float64
+	}{
+		{"NTSC", 0x00, 0x00, 0x00, ntscFrameRate, ntscCpuFrequency},
+		{"PAL", 0x00, 0x01, 0x00, palFrameRate, palCpuFrequency},
+		{"Dendy", 0x08, 0x00, 0x03, palFrameRate, dendyCpuFrequency},
+	}
+	for _, test := range tests {
+		cart := makeIdleCartridge()
+		cart.header.Flag7 = test.flag7
+		cart.header.Flag9 = test.flag9
+		cart.header.Flag12 = test.flag12
+		nes := makeTestNES(cart)
+		if got := nes.FrameRate(); got != test.frameRate {
+			t.Errorf("%v: expected %v Hz, got %v", test.name, test.frameRate, got)
+		}
+
+		nes.StepFrame()
+		start := nes.cpu.cycles
+		for i := 0; i < 10; i++ {
+			nes.StepFrame()
+		}
+		frequency := float64(nes.cpu.cycles-start) / 10 * test.frameRate
+		if math.Abs(frequency-test.cpuFrequency) > test.cpuFrequency/1000 {
+			t.Errorf("%v: frames run the CPU at %.0f Hz, expected %v", test.name, frequency, test.cpuFrequency)
+		}
+	}
+}
+
+func readButtons(nes *NES, port int) byte {
+	nes.WriteCPU(0x4016, 1)
+	nes.WriteCPU(0x4016, 0)
+	var got byte
+	for i := 0; i < 8; i++ {
+		got |= (nes.ReadCPU(0x4016+uint16(port)) & 1) << i
+	}
+	return got
+}
+
+func TestTurboButtons(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.SetTurboRate(0, 2)
+	nes.SetButtons(0, ButtonUp)
+	nes.SetTurboButtons(0, ButtonA)
+
+	var got []byte
+	for i := 0; i < 6; i++ {
+		got = append(got, readButtons(nes, 0))
+		nes.StepFrame()
+	}
+	on, off := byte(ButtonUp|ButtonA), byte(ButtonUp)
+	if want := []byte{on, on, off, off, on, on}; string(got) != string(want) {
+		t.Errorf("expected turbo frames %v, got %v", want, got)
+	}
+
+	//Letting go restarts the cycle pressed
+	nes.SetTurboButtons(0, 0)
+	nes.SetTurboButtons(0, ButtonA)
+	if readButtons(nes, 0) != on {
+		t.Errorf("turbo should start pressed")
+	}
+}
+
+func TestPlayMacro(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.SetButtons(1, ButtonB)
+	nes.PlayMacro(1, Macro{Name: "fireball", Frames: []byte{ButtonDown, ButtonDown | ButtonRight, ButtonRight | ButtonA}})
+
+	var got []byte
+	for i := 0; i < 4; i++ {
+		got = append(got, readButtons(nes, 1))
+		nes.StepFrame()
+	}
+	want := []byte{ButtonB | ButtonDown, ButtonB | ButtonDown | ButtonRight, ButtonB | ButtonRight | ButtonA, ButtonB}
+	if string(got) != string(want) {
+		t.Errorf("expected macro frames %v, got %v", want, got)
+	}
+}
+
+func TestRegisterReadsLandOnTheirCycle(t *testing.T) {
+	for _, test := range []struct {
+		dot int //on scanline 240, VBlank starts at dot 1 of 241
+		read byte
+		status byte
+	}{
+		{333, 0x00, 0x80}, //a dot too early, VBlank starts later in the instruction
+		{334, 0x80, 0x00}, //the read on the 4th cycle sees VBlank and clears it
+	} {
+		nes := makeTestNES(makeIdleCartridge())
+		copy(nes.ram[0x200:], []byte{0xAD, 0x02, 0x20}) //LDA $2002
+		nes.cpu.PC = 0x200
+		nes.ppu.scanline, nes.ppu.cycles = 240, test.dot
+		nes.StepInstruction()
+		if nes.cpu.A&0x80 != test.read || nes.ppu.status&0x80 != test.status {
+			t.Errorf("dot %v: expected $%02X read with $%02X left, got $%02X with $%02X", test.dot, test.read, test.status,
+				nes.cpu.A&0x80, nes.ppu.status&0x80)
+		}
+	}
+}
+
+func TestNMIOnTheLastCycleWaitsAnInstruction(t *testing.T) {
+	for _, test := range []struct {
+		dot int
+		nops int //that run before the NMI
+	}{
+		{340, 1}, //VBlank on the first cycle of the NOP
+		{338, 2}, //VBlank on the last cycle, after the poll
+	} {
+		nes := makeTestNES(makeIdleCartridge())
+		nes.cart.prg[0x7FFA], nes.cart.prg[0x7FFB] = 0x00, 0x90
+		copy(nes.ram[0x200:], []byte{0xEA, 0xEA, 0xEA}) //NOP
+		nes.cpu.PC = 0x200
+		nes.WriteCPU(0x2000, 0x80)
+		nes.ppu.scanline, nes.ppu.cycles = 240, test.dot
+
+		for i := 0; i < test.nops; i++ {
+			nes.StepInstruction()
+		}
+		nes.StepInstruction()
+		if nes.cpu.PC != 0x9000 || nes.ram[0x1FC] != byte(0x200+test.nops) {
+			t.Errorf("dot %v: expected the NMI after %v NOPs, got PC $%04X returning to $%02X", test.dot, test.nops, nes.cpu.PC, nes.ram[0x1FC])
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package nes
+
+//https://wiki.nesdev.com/w/index.php/Input_devices
+//Anything plugged into controller port 1, 2 or the Famicom expansion port
+type PortDevice interface {
+	//Every write to $4016, bit 0 is the strobe line, bits 1-2 go to the expansion port
+	Strobe(value byte)
+	//A read of the port's register, only bits 0-4 reach the data bus
+	Read() byte
+	//Called after every StepFrame for input that moves on frame by frame
+	Latch()
+}
+
+//Expansion port devices see reads of both $4016 and $4017, e.g. the Famicom
+//Zapper answers on $4017 while a third controller answers on $4016.
+//A PortDevice without ReadExpansion is read on $4016 bit 1.
+type ExpansionDevice interface {
+	PortDevice
+	ReadExpansion(port int) byte
+}
+
+//Port numbers for ConnectDevice
+const (
+	Port1 = 0
+	Port2 = 1
+	ExpansionPort = 2
+)
+
+//Plugs device into Port1, Port2 or ExpansionPort, replacing what was there.
+//nil leaves the port empty. Devices can be swapped between frames.
+func (nes *NES) ConnectDevice(port int, device PortDevice) {
+	if port >= 0 && port < len(nes.ports) {
+		nes.ports[port] = device
+	}
+}
+
+//The device in Port1, Port2 or ExpansionPort, nil when empty
+func (nes *NES) Device(port int) PortDevice {
+	if port >= 0 && port < len(nes.ports) {
+		return nes.ports[port]
+	}
+	return nil
+}
+
+//The console's controllers 0-3, SetButtons presses their buttons.
+//0 and 1 start out in the controller ports, 2 and 3 are for multitaps.
+func (nes *NES) Controller(i int) *GameController {
+	if i >= 0 && i < len(nes.controllers) {
+		return nes.controllers[i]
+	}
+	return nil
+}
+
+//A Zapper wired to this console's picture, AimZapper aims the one for port 0 or 1
+func (nes *NES) Zapper(port int) *Zapper {
+	if port >= 0 && port < len(nes.zappers) {
+		return nes.zappers[port]
+	}
+	return nil
+}
+
+func (nes *NES) strobePorts(value byte) {
+	for _, device := range nes.ports {
+		if device != nil {
+			device.Strobe(value)
+		}
+	}
+}
+
+func (nes *NES) latchPorts() {
+	for _, device := range nes.ports {
+		if device != nil {
+			device.Latch()
+		}
+	}
+}
+
+//$4016 or $4017, what the port and the expansion port drive together
+func (nes *NES) readPort(port int) byte {
+	var value byte
+	if device := nes.ports[port]; device != nil {
+		value = device.Read()
+	}
+
+	switch expansion := nes.ports[ExpansionPort].(type) {
+	case nil:
+	case ExpansionDevice:
+		value |= expansion.ReadExpansion(port)
+	default:
+		if port == Port1 {
+			value |= expansion.Read() << 1
+		}
+	}
+	return value & 0x1F
+}
@@ -0,0 +1,49 @@
+package nes
+
+import (
+	"testing"
+)
+
+//Counts calls to check the console drives devices it did not make
+type testDevice struct {
+	strobes, reads, latches int
+	value                   byte
+}
+
+func (d *testDevice) Strobe(value byte) { d.strobes++ }
+func (d *testDevice) Read() byte        { d.reads++; return d.value }
+func (d *testDevice) Latch()            { d.latches++ }
+
+func TestPortDevices(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	device := &testDevice{value: 0xFF}
+	nes.ConnectDevice(Port1, device)
+	if nes.Device(Port1) != device {
+		t.Errorf("Device should return what was connected")
+	}
+
+	nes.WriteCPU(0x4016, 1)
+	if got := nes.ReadCPU(0x4016); got != 0x1F {
+		t.Errorf("only bits 0-4 should come from the device, got $%02X", got)
+	}
+	nes.StepFrame()
+	if device.strobes != 1 || device.reads != 1 || device.latches != 1 {
+		t.Errorf("expected one strobe, read and latch, got %+v", device)
+	}
+
+	//Empty ports read nothing, a plain device in the expansion port answers on $4016 D1
+	nes.ConnectDevice(Port1, nil)
+	nes.ConnectDevice(ExpansionPort, nes.Controller(2))
+	nes.SetButtons(2, ButtonA)
+	if got := nes.ReadCPU(0x4016) & 0x1F; got != 0x02 {
+		t.Errorf("expected the third controller on D1, got $%02X", got)
+	}
+	if got := nes.ReadCPU(0x4017) & 0x1F; got != 0 {
+		t.Errorf("the third controller should not answer on $4017, got $%02X", got)
+	}
+
+	nes.ConnectMultitap(MultitapNone)
+	if nes.Device(Port1) != nes.Controller(0) || nes.Device(ExpansionPort) != nil {
+		t.Errorf("MultitapNone should go back to the two controllers")
+	}
+}
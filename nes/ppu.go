@@ -1,12 +1,24 @@
-package main
+package nes
 
 import (
 _	"fmt"
-	"log"
+	"image"
+_	"log"
 _	"os"
 _	"runtime/debug"
 )
 
+const (
+	ScreenWidth  = 256
+	ScreenHeight = 240
+)
+
+//Receives every completed frame at the end of the last scanline. The image
+//is reused by the PPU, so copy it if it has to outlive the next frame.
+type FrameSink interface {
+	Present(frame *image.RGBA)
+}
+
 type PPU struct {
 	nes *NES
 
@@ -43,6 +55,16 @@ type PPU struct {
 
 	cycles   int
 	scanline int
+	vblankScanline    int
+	preRenderScanline int //last of the frame
+	totalCycles uint64
+	frame uint64
+
+	addressObserver PPUAddressObserver
+
+	frameBuffer *image.RGBA //being drawn
+	frontBuffer *image.RGBA //last completed frame
+	frameSink   FrameSink
 
 	nametableLatch byte
 	attributeLatch byte
@@ -53,9 +75,9 @@ type PPU struct {
 }
 
 func (ppu *PPU) Run() {
-	isPreScanline := ppu.scanline == 261
+	isPreScanline := ppu.scanline == ppu.preRenderScanline
 	isRenderingScanline := ppu.scanline <= 239
-	isVerticalBlank := ppu.scanline == 241
+	isVerticalBlank := ppu.scanline == ppu.vblankScanline
 
 	//fmt.Printf("SC:%v CYC:%v $V:%X $T:%X\n",ppu.scanline, ppu.cycles, ppu.v, ppu.t)
 
@@ -74,11 +96,16 @@ func (ppu *PPU) Run() {
 	}
 
 	ppu.cycles++
+	ppu.totalCycles++
 	if ppu.cycles == 341 {
 		ppu.scanline++
-		if ppu.scanline == 262 {
-			drawFrame()
+		if ppu.scanline > ppu.preRenderScanline {
+			ppu.frameBuffer, ppu.frontBuffer = ppu.frontBuffer, ppu.frameBuffer
+			if ppu.frameSink != nil {
+				ppu.frameSink.Present(ppu.frontBuffer)
+			}
 			ppu.scanline = 0
+			ppu.frame++
 		}
 		ppu.cycles = 0
 	}
@@ -265,12 +292,13 @@ func (ppu *PPU) renderPixel() {
 	g := byte(pixelColor>>8) & 0xFF
 	b := byte(pixelColor>>0) & 0xFF
 
-	if x >= 0 && x <= 256 && y < windowHeight { //only render 240 scanline
-		renderBuffer[(y*windowWidth+x)*4+0] = b
-		renderBuffer[(y*windowWidth+x)*4+1] = g
-		renderBuffer[(y*windowWidth+x)*4+2] = r
-		renderBuffer[(y*windowWidth+x)*4+3] = a
-	}	
+	if x >= 0 && x < ScreenWidth && y < ScreenHeight { //only render 240 scanline
+		i := ppu.frameBuffer.PixOffset(x, y)
+		ppu.frameBuffer.Pix[i+0] = r
+		ppu.frameBuffer.Pix[i+1] = g
+		ppu.frameBuffer.Pix[i+2] = b
+		ppu.frameBuffer.Pix[i+3] = a
+	}
 }
 
 func (ppu *PPU) getBackgroundPixel() byte {
@@ -345,6 +373,11 @@ func (ppu *PPU) doSpriteEvaluation() {
 		ppu.setSpriteOverflow()
 	}
 	ppu.spriteInScanlineCount = spriteCount
+
+	//Unused slots still fetch tile $FF, mappers watching A12 rely on it
+	for i := spriteCount; i < 8; i++ {
+		ppu.getSpritePatterns(0, 0xFF, 0)
+	}
 }
 
 func (ppu *PPU) getSpritePatterns(a byte, t byte, row int) uint32 {
@@ -488,6 +521,19 @@ func MakeNewPPU(nes *NES) *PPU {
 	ppu := PPU{
 		nes:     nes,
 		palette: p,
+		frameBuffer: image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight)),
+		frontBuffer: image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight)),
+	}
+	ppu.addressObserver, _ = nes.mapper.(PPUAddressObserver)
+
+	//https://wiki.nesdev.com/w/index.php/Cycle_reference_chart
+	//PAL and Dendy draw 312 lines, Dendy holds off vertical blank for 50 of the extra ones
+	ppu.vblankScanline, ppu.preRenderScanline = 241, 261
+	switch nes.cart.getTimingMode() {
+	case timingPAL:
+		ppu.preRenderScanline = 311
+	case timingDendy:
+		ppu.vblankScanline, ppu.preRenderScanline = 291, 311
 	}
 	ppu.Reset()
 	return &ppu
@@ -525,7 +571,7 @@ func (ppu *PPU) WriteRegisters(addr uint16, data byte) {
 	case addr == 0x4014:
 		ppu.WriteOamDma(data)
 	default:
-		log.Fatalf("$%x is invalid", addr)
+		ppu.nes.diagnose(addr, "write of $%02X to read-only PPU register", data)
 	}
 }
 
@@ -598,10 +644,10 @@ func (ppu *PPU) ReadRegisters(addr uint16) byte {
 		return ppu.ReadOamData()
 	case addr == 0x2007:
 		return ppu.ReadData()
-	default:
-		log.Fatalf("$%x is invalid address", addr)
+	default: //the PPU's own data bus latch
+		ppu.nes.diagnose(addr, "read from write-only PPU register")
+		return ppu.lastRegisterWrite
 	}
-	return 0
 }
 
 func (ppu *PPU) ReadStatus() byte {
@@ -643,3 +689,26 @@ func (ppu *PPU) WritePalette(addr uint16, value byte) {
 func (ppu *PPU) ReadPalette(addr uint16) byte {
 	return ppu.paletteInfo[addr]
 }
+
+//The palette lookup is a constant table, paletteInfo holds what the game wrote
+func (ppu *PPU) saveState(s *stateWriter) {
+	s.write(ppu.ctrl, ppu.mask, ppu.status, ppu.oamaddr, ppu.oamdata, ppu.scroll, ppu.addr, ppu.data, ppu.oamdma,
+		ppu.v, ppu.t, ppu.x, ppu.w, ppu.lastRegisterWrite,
+		ppu.oam, ppu.spritePosition, ppu.spritePatterns, ppu.spritePriority,
+		ppu.vram, ppu.paletteInfo, ppu.totalCycles, ppu.frame,
+		ppu.nametableLatch, ppu.attributeLatch, ppu.patternLowLatch, ppu.patternHighLatch, ppu.backgroundTile)
+	s.writeInt(ppu.spriteIds[:]...)
+	s.writeInt(ppu.spriteInScanlineCount, ppu.cycles, ppu.scanline)
+}
+
+func (ppu *PPU) loadState(s *stateReader) {
+	s.read(&ppu.ctrl, &ppu.mask, &ppu.status, &ppu.oamaddr, &ppu.oamdata, &ppu.scroll, &ppu.addr, &ppu.data, &ppu.oamdma,
+		&ppu.v, &ppu.t, &ppu.x, &ppu.w, &ppu.lastRegisterWrite,
+		&ppu.oam, &ppu.spritePosition, &ppu.spritePatterns, &ppu.spritePriority,
+		&ppu.vram, &ppu.paletteInfo, &ppu.totalCycles, &ppu.frame,
+		&ppu.nametableLatch, &ppu.attributeLatch, &ppu.patternLowLatch, &ppu.patternHighLatch, &ppu.backgroundTile)
+	for i := range ppu.spriteIds {
+		s.readInt(&ppu.spriteIds[i])
+	}
+	s.readInt(&ppu.spriteInScanlineCount, &ppu.cycles, &ppu.scanline)
+}
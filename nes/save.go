@@ -0,0 +1,74 @@
+package nes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Battery-backed wram is flushed at most this often while running
+const SaveFlushFrames = 60
+
+//zelda.nes -> <saveDir>/zelda.sav, saveDir defaults to the rom's directory
+func SavePath(romPath string, saveDir string) string {
+	if saveDir == "" {
+		saveDir = filepath.Dir(romPath)
+	}
+	base := filepath.Base(romPath)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(saveDir, base+".sav")
+}
+
+//A missing save file is not an error, the game just starts fresh
+func (cart *Cartridge) LoadSave(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	copy(cart.wram, data)
+	cart.isWramDirty = false
+	return nil
+}
+
+//Written to a temporary file first so a crash mid-write keeps the old save
+func (cart *Cartridge) WriteSave(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, cart.wram, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+
+	cart.isWramDirty = false
+	return nil
+}
+
+func (nes *NES) HasBattery() bool {
+	return nes.cart.hasBattery()
+}
+
+//Battery-backed wram written since the last LoadSave or WriteSave
+func (nes *NES) IsSaveDirty() bool {
+	return nes.cart.isWramDirty
+}
+
+func (nes *NES) LoadSave(path string) error {
+	return nes.cart.LoadSave(path)
+}
+
+func (nes *NES) WriteSave(path string) error {
+	return nes.cart.WriteSave(path)
+}
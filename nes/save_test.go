@@ -0,0 +1,82 @@
+package nes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "nelr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSavePath(t *testing.T) {
+	if got := SavePath("roms/zelda.nes", ""); got != filepath.Join("roms", "zelda.sav") {
+		t.Errorf("unexpected default save path %v", got)
+	}
+	if got := SavePath("roms/zelda.nes", "saves"); got != filepath.Join("saves", "zelda.sav") {
+		t.Errorf("unexpected save path %v", got)
+	}
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "saves", "game.sav")
+
+	cart := makeTestCartridge(1, 2, 1)
+	nes := makeTestNES(cart)
+	nes.Write(0x6000, 0x12)
+	nes.Write(0x7FFF, 0x34)
+	if !cart.isWramDirty {
+		t.Errorf("wram writes should mark the save dirty")
+	}
+
+	if err := cart.WriteSave(path); err != nil {
+		t.Fatal(err)
+	}
+	if cart.isWramDirty {
+		t.Errorf("writing the save should clear the dirty flag")
+	}
+
+	loaded := makeTestCartridge(1, 2, 1)
+	if err := loaded.LoadSave(path); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.wram, cart.wram) {
+		t.Errorf("loaded wram differs from saved wram")
+	}
+}
+
+func TestLoadMissingSave(t *testing.T) {
+	cart := makeTestCartridge(1, 2, 1)
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	err := cart.LoadSave(filepath.Join(dir, "missing.sav"))
+	if err != nil {
+		t.Errorf("missing save should not be an error, got %v", err)
+	}
+}
+
+func TestLoadShortSave(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "short.sav")
+	if err := ioutil.WriteFile(path, []byte{1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cart := makeTestCartridge(1, 2, 1)
+	if err := cart.LoadSave(path); err != nil {
+		t.Fatal(err)
+	}
+	if cart.wram[0] != 1 || cart.wram[2] != 3 || cart.wram[3] != 0 {
+		t.Errorf("short save should fill the start of wram")
+	}
+}
@@ -0,0 +1,185 @@
+package nes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Save state layout: magic, version, rom hash, then every component in a fixed order.
+//Bump stateVersion whenever a component changes what it writes.
+const (
+	stateMagic   = "NELRSTAT"
+	stateVersion = 8
+)
+
+var (
+	ErrStateMagic       = errors.New("not a nelr save state")
+	ErrStateVersion     = errors.New("save state version not supported")
+	ErrStateRomMismatch = errors.New("save state belongs to a different rom")
+	ErrStateCorrupt     = errors.New("save state is corrupt")
+)
+
+//Sticky error writer, components write field by field and check once at the end
+type stateWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (s *stateWriter) write(values ...interface{}) {
+	for _, value := range values {
+		if s.err != nil {
+			return
+		}
+		s.err = binary.Write(s.w, binary.LittleEndian, value)
+	}
+}
+
+func (s *stateWriter) writeInt(values ...int) {
+	for _, value := range values {
+		s.write(int64(value))
+	}
+}
+
+type stateReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *stateReader) read(values ...interface{}) {
+	for _, value := range values {
+		if s.err != nil {
+			return
+		}
+		s.err = binary.Read(s.r, binary.LittleEndian, value)
+	}
+}
+
+func (s *stateReader) readInt(values ...*int) {
+	for _, value := range values {
+		var v int64
+		s.read(&v)
+		*value = int(v)
+	}
+}
+
+//Identifies the rom a state belongs to, CHR RAM is state so it is left out
+func (cart *Cartridge) hash() [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(cart.prg)
+	if !cart.hasChrRam {
+		h.Write(cart.chr)
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func (nes *NES) SaveState(w io.Writer) error {
+	s := &stateWriter{w: w}
+	s.write([]byte(stateMagic), uint32(stateVersion), nes.cart.hash())
+
+	s.write(nes.ram[:0x0800])
+	nes.cpu.saveState(s)
+	nes.ppu.saveState(s)
+	nes.apu.saveState(s)
+	for _, controller := range nes.controllers {
+		controller.saveState(s)
+	}
+	nes.fourScore.saveState(s)
+	nes.cart.saveState(s)
+	nes.mapper.saveState(s)
+
+	return s.err
+}
+
+//The machine is only touched once the header checks out, and a state
+//that turns out truncated is rolled back to what was running before
+func (nes *NES) LoadState(r io.Reader) error {
+	s := &stateReader{r: r}
+	magic := make([]byte, len(stateMagic))
+	var version uint32
+	var romHash [sha256.Size]byte
+	s.read(magic, &version, &romHash)
+
+	switch {
+	case s.err != nil:
+		return s.err
+	case string(magic) != stateMagic:
+		return ErrStateMagic
+	case version != stateVersion:
+		return fmt.Errorf("%w: %v", ErrStateVersion, version)
+	case romHash != nes.cart.hash():
+		return ErrStateRomMismatch
+	}
+
+	var previous bytes.Buffer
+	if err := nes.SaveState(&previous); err != nil {
+		return err
+	}
+
+	nes.loadComponents(s)
+	if s.err != nil {
+		rollback := &stateReader{r: bytes.NewReader(previous.Bytes()[len(stateMagic)+4+sha256.Size:])}
+		nes.loadComponents(rollback)
+	}
+	return s.err
+}
+
+func (nes *NES) loadComponents(s *stateReader) {
+	s.read(nes.ram[:0x0800])
+	nes.cpu.loadState(s)
+	nes.ppu.loadState(s)
+	nes.apu.loadState(s)
+	for _, controller := range nes.controllers {
+		controller.loadState(s)
+	}
+	nes.fourScore.loadState(s)
+	nes.cart.loadState(s)
+	nes.mapper.loadState(s)
+	nes.syncedCycles = nes.cpu.cycles
+}
+
+//Written to a temporary file first like battery saves
+func (nes *NES) SaveStateFile(path string) error {
+	var state bytes.Buffer
+	err := nes.SaveState(&state)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, state.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (nes *NES) LoadStateFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return nes.LoadState(file)
+}
+
+//zelda.nes slot 1 -> <saveDir>/zelda.st1
+func StatePath(romPath string, saveDir string, slot int) string {
+	sav := SavePath(romPath, saveDir)
+	return strings.TrimSuffix(sav, filepath.Ext(sav)) + fmt.Sprintf(".st%d", slot)
+}
@@ -0,0 +1,127 @@
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func saveTestState(t *testing.T, nes *NES) []byte {
+	var state bytes.Buffer
+	if err := nes.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	return state.Bytes()
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(1, 8, 0))
+	nes.Write(0x0042, 0x99)
+	nes.Write(0x6000, 0x12)
+	nes.Write(0x4015, 0x01)
+	nes.Write(0x4003, 0x18)
+	nes.Write(0x2000, 0x80)
+	writeMMC1Register(nes, 0xE000, 0x03)
+	nes.cpu.A = 0x55
+	nes.cpu.PC = 0x8123
+	nes.ppu.oam[7] = 0x77
+	nes.Read(0x2002)
+	nes.Write(0x2006, 0x00)
+	nes.Write(0x2006, 0x10)
+	nes.Write(0x2007, 0xAB) //CHR RAM
+	nes.PlayMacro(1, Macro{Frames: []byte{ButtonA, ButtonB}})
+	nes.controllers[1].Latch()
+	saved := saveTestState(t, nes)
+
+	nes.Write(0x0042, 0x00)
+	nes.Write(0x6000, 0x00)
+	nes.Write(0x4015, 0x00)
+	nes.Write(0x2000, 0x00)
+	writeMMC1Register(nes, 0xE000, 0x00)
+	nes.cpu.A = 0
+	nes.cpu.PC = 0
+	nes.ppu.oam[7] = 0
+	nes.cart.chr[0x10] = 0
+	nes.PlayMacro(1, Macro{})
+
+	if err := nes.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saveTestState(t, nes), saved) {
+		t.Errorf("saving a loaded state should reproduce it exactly")
+	}
+	if nes.Read(0x0042) != 0x99 || nes.Read(0x6000) != 0x12 || nes.cpu.A != 0x55 || nes.cpu.PC != 0x8123 {
+		t.Errorf("cpu, ram or wram not restored")
+	}
+	if nes.ppu.ctrl != 0x80 || nes.ppu.oam[7] != 0x77 || nes.cart.chr[0x10] != 0xAB {
+		t.Errorf("ppu or chr ram not restored")
+	}
+	if got := nes.Read(0x8000); got != 3 {
+		t.Errorf("mmc1 prg bank not restored, got bank %v", got)
+	}
+	if nes.apu.pulse1.lengthCounter != 2 {
+		t.Errorf("apu not restored")
+	}
+	if len(nes.controllers[1].macro) != 1 || nes.controllers[1].macro[0] != ButtonB {
+		t.Errorf("macro progress not restored")
+	}
+}
+
+func TestStateRejectsOtherRom(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 2, 1))
+	saved := saveTestState(t, nes)
+
+	other := makeTestNES(makeTestCartridge(0, 1, 1))
+	other.Write(0x0000, 0x42)
+	err := other.LoadState(bytes.NewReader(saved))
+	if !errors.Is(err, ErrStateRomMismatch) {
+		t.Errorf("expected a rom mismatch, got %v", err)
+	}
+	if other.Read(0x0000) != 0x42 {
+		t.Errorf("a rejected state should leave the machine untouched")
+	}
+
+	if err := nes.LoadState(bytes.NewReader([]byte("NES\x1a0000000000000000000000000000000000000000000000"))); !errors.Is(err, ErrStateMagic) {
+		t.Errorf("expected a bad magic error, got %v", err)
+	}
+}
+
+func TestStateTruncatedRollsBack(t *testing.T) {
+	nes := makeTestNES(makeTestCartridge(0, 2, 1))
+	nes.Write(0x0010, 0x01)
+	saved := saveTestState(t, nes)
+
+	nes.Write(0x0010, 0x02)
+	before := saveTestState(t, nes)
+	if err := nes.LoadState(bytes.NewReader(saved[:len(saved)-10])); err == nil {
+		t.Errorf("a truncated state should fail to load")
+	}
+	if !bytes.Equal(saveTestState(t, nes), before) {
+		t.Errorf("a failed load should restore the running machine")
+	}
+}
+
+func TestStateFileSlots(t *testing.T) {
+	if got := StatePath("roms/zelda.nes", "saves", 3); got != filepath.Join("saves", "zelda.st3") {
+		t.Errorf("unexpected state path %v", got)
+	}
+
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := StatePath(filepath.Join(dir, "game.nes"), "", 1)
+
+	nes := makeTestNES(makeTestCartridge(0, 2, 1))
+	nes.cpu.X = 0x21
+	if err := nes.SaveStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	nes.cpu.X = 0
+	if err := nes.LoadStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if nes.cpu.X != 0x21 {
+		t.Errorf("state file not restored")
+	}
+}
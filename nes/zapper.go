@@ -0,0 +1,77 @@
+package nes
+
+//https://wiki.nesdev.com/w/index.php/Zapper
+type Zapper struct {
+	ppu *PPU
+
+	x, y int //screen pixel the gun points at, off screen when outside 256x240
+	trigger bool
+}
+
+//The photodiode keeps reporting light for a while after the beam has passed
+const zapperLightScanlines = 20
+
+//Luma a pixel needs for the photodiode to notice it, white and the light grays
+const zapperBrightness = 0xC0
+
+func MakeNewZapper(ppu *PPU) *Zapper {
+	return &Zapper{
+		ppu: ppu,
+		x: -1,
+		y: -1,
+	}
+}
+
+//The Zapper has no shift register, strobing does nothing
+func (z *Zapper) Strobe(value byte) {
+}
+
+//Position and trigger come straight from Aim
+func (z *Zapper) Latch() {
+}
+
+//D3 is 0 while light is sensed, D4 is 1 while the trigger is pulled
+func (z *Zapper) Read() byte {
+	var value byte
+	if !z.sensesLight() {
+		value |= 0x08
+	}
+	if z.trigger {
+		value |= 0x10
+	}
+	return value
+}
+
+//Famicom Zappers plug into the expansion port and answer on $4017
+func (z *Zapper) ReadExpansion(port int) byte {
+	if port == Port2 {
+		return z.Read()
+	}
+	return 0
+}
+
+//Points the gun at screen pixel x, y, off the screen aims away from the TV
+func (z *Zapper) Aim(x int, y int, trigger bool) {
+	z.x = x
+	z.y = y
+	z.trigger = trigger
+}
+
+//Light comes from the frame being drawn, only once the beam has drawn the
+//aimed pixel and for zapperLightScanlines after
+func (z *Zapper) sensesLight() bool {
+	if z.x < 0 || z.x >= ScreenWidth || z.y < 0 || z.y >= ScreenHeight {
+		return false
+	}
+	scanline := z.ppu.scanline
+	if scanline < z.y || scanline >= z.y+zapperLightScanlines {
+		return false
+	}
+	if scanline == z.y && z.ppu.cycles <= z.x+1 {
+		return false
+	}
+
+	pixel := z.ppu.frameBuffer.RGBAAt(z.x, z.y)
+	luma := (299*int(pixel.R) + 587*int(pixel.G) + 114*int(pixel.B)) / 1000
+	return luma >= zapperBrightness
+}
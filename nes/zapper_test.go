@@ -0,0 +1,67 @@
+package nes
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestZapper(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.ConnectDevice(Port2, nes.Zapper(Port2))
+	nes.ppu.frameBuffer.SetRGBA(100, 50, color.RGBA{0xFC, 0xFC, 0xFC, 0xFF})
+	nes.AimZapper(1, 100, 50, true)
+
+	for _, test := range []struct {
+		scanline, cycles int
+		value            byte
+	}{
+		{49, 200, 0x18},  //beam not there yet
+		{50, 101, 0x18},  //pixel 100 is drawn on cycle 101
+		{50, 102, 0x10},  //just drawn
+		{65, 0, 0x10},    //photodiode still lit
+		{70, 0, 0x18},    //faded
+	} {
+		nes.ppu.scanline, nes.ppu.cycles = test.scanline, test.cycles
+		if got := nes.ReadCPU(0x4017) & 0x1F; got != test.value {
+			t.Errorf("scanline %v cycle %v: expected $%02X, got $%02X", test.scanline, test.cycles, test.value, got)
+		}
+	}
+
+	//Dark pixels and aiming off screen sense nothing
+	nes.ppu.scanline, nes.ppu.cycles = 55, 0
+	nes.AimZapper(1, 101, 50, false)
+	if got := nes.ReadCPU(0x4017) & 0x1F; got != 0x08 {
+		t.Errorf("dark pixel: expected $08, got $%02X", got)
+	}
+	nes.AimZapper(1, -1, -1, true)
+	if got := nes.ReadCPU(0x4017) & 0x1F; got != 0x18 {
+		t.Errorf("off screen: expected $18, got $%02X", got)
+	}
+
+	//Port 1 keeps its controller
+	nes.SetButtons(0, ButtonA)
+	nes.WriteCPU(0x4016, 1)
+	if nes.ReadCPU(0x4016)&1 != 1 {
+		t.Errorf("port 1 should still read the controller")
+	}
+	nes.ConnectDevice(Port2, nes.Controller(1))
+	nes.SetButtons(1, ButtonA)
+	if nes.ReadCPU(0x4017)&0x1F != 1 {
+		t.Errorf("port 2 should read the controller again")
+	}
+}
+
+func TestFamicomZapper(t *testing.T) {
+	nes := makeTestNES(makeIdleCartridge())
+	nes.ConnectDevice(ExpansionPort, nes.Zapper(Port2))
+	nes.AimZapper(Port2, -1, -1, true)
+	nes.SetButtons(1, ButtonA)
+	nes.WriteCPU(0x4016, 1)
+
+	if got := nes.ReadCPU(0x4017) & 0x1F; got != 0x19 {
+		t.Errorf("expected the controller and the Zapper on $4017, got $%02X", got)
+	}
+	if got := nes.ReadCPU(0x4016) & 0x1F; got != 0 {
+		t.Errorf("the Famicom Zapper should leave $4016 alone, got $%02X", got)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+)
+
+//Falling further behind than this gives up on catching up, e.g. after a pause
+const maxPacerLag = 5
+
+//Sleeps between frames to hold the emulated frame rate in real time
+type framePacer struct {
+	frameDuration time.Duration
+	next          time.Time
+
+	now   func() time.Time
+	sleep func(d time.Duration)
+}
+
+func MakeNewFramePacer(frameRate float64) *framePacer {
+	return &framePacer{
+		frameDuration: time.Duration(float64(time.Second) / frameRate),
+		now:           time.Now,
+		sleep:         time.Sleep,
+	}
+}
+
+//Waits out the rest of the current frame, speed 2 runs twice as fast
+func (p *framePacer) wait(speed float64) {
+	now := p.now()
+	duration := time.Duration(float64(p.frameDuration) / speed)
+	if p.next.IsZero() || now.Sub(p.next) > maxPacerLag*duration {
+		p.next = now
+	}
+
+	p.next = p.next.Add(duration)
+	if delay := p.next.Sub(now); delay > 0 {
+		p.sleep(delay)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.slept += d
+}
+
+func makeTestPacer(clock *fakeClock) *framePacer {
+	p := MakeNewFramePacer(60.0988)
+	p.now = func() time.Time { return clock.now }
+	p.sleep = clock.sleep
+	return p
+}
+
+func TestFramePacerHoldsFrameRate(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := makeTestPacer(clock)
+
+	start := clock.now
+	for i := 0; i < 601; i++ {
+		clock.now = clock.now.Add(time.Millisecond) //emulating a frame
+		p.wait(1)
+	}
+	if elapsed := clock.now.Sub(start); elapsed < 9999*time.Millisecond || elapsed > 10020*time.Millisecond {
+		t.Errorf("601 frames at 60.0988 Hz should take 10s, took %v", elapsed)
+	}
+}
+
+func TestFramePacerSpeed(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := makeTestPacer(clock)
+	p.wait(1)
+
+	clock.slept = 0
+	p.wait(4)
+	if want := p.frameDuration / 4; clock.slept != want {
+		t.Errorf("fast-forward should sleep %v, slept %v", want, clock.slept)
+	}
+	clock.slept = 0
+	p.wait(0.5)
+	if want := p.frameDuration * 2; clock.slept != want {
+		t.Errorf("slow motion should sleep %v, slept %v", want, clock.slept)
+	}
+}
+
+func TestFramePacerResyncsAfterStall(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := makeTestPacer(clock)
+	p.wait(1)
+
+	clock.now = clock.now.Add(time.Second)
+	clock.slept = 0
+	p.wait(1)
+	p.wait(1)
+	if clock.slept < p.frameDuration {
+		t.Errorf("a long stall should not be made up by running flat out")
+	}
+}
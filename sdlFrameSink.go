@@ -0,0 +1,63 @@
+package main
+
+import (
+	"image"
+	"unsafe"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"nelr/nes"
+)
+
+//Presents frames in a resizable SDL window
+type sdlFrameSink struct {
+	window   *sdl.Window
+	renderer *sdl.Renderer
+	texture  *sdl.Texture
+}
+
+func MakeNewSDLFrameSink() (*sdlFrameSink, error) {
+	var sink sdlFrameSink
+	var err error
+
+	sink.window, sink.renderer, err = sdl.CreateWindowAndRenderer(nes.ScreenWidth, nes.ScreenHeight, sdl.WINDOW_RESIZABLE)
+	if err != nil {
+		return nil, err
+	}
+	//image.RGBA byte order on little-endian
+	sink.texture, err = sink.renderer.CreateTexture(sdl.PIXELFORMAT_ABGR8888, sdl.TEXTUREACCESS_STREAMING, nes.ScreenWidth, nes.ScreenHeight)
+	if err != nil {
+		sink.Destroy()
+		return nil, err
+	}
+
+	return &sink, nil
+}
+
+func (sink *sdlFrameSink) Present(frame *image.RGBA) {
+	sink.texture.Update(nil, unsafe.Pointer(&frame.Pix[0]), frame.Stride)
+	sink.renderer.Clear()
+	sink.renderer.Copy(sink.texture, nil, nil)
+	sink.renderer.Present()
+}
+
+//Window coordinates to NES screen pixels, the frame is stretched over the whole window
+func (sink *sdlFrameSink) screenPosition(x int32, y int32) (int, int) {
+	width, height := sink.window.GetSize()
+	if width <= 0 || height <= 0 {
+		return -1, -1
+	}
+	return int(x) * nes.ScreenWidth / int(width), int(y) * nes.ScreenHeight / int(height)
+}
+
+func (sink *sdlFrameSink) SetTitle(title string) {
+	sink.window.SetTitle(title)
+}
+
+func (sink *sdlFrameSink) Destroy() {
+	if sink.texture != nil {
+		sink.texture.Destroy()
+	}
+	sink.renderer.Destroy()
+	sink.window.Destroy()
+}